@@ -16,6 +16,7 @@ package cluster
 
 import (
 	"fmt"
+	"io"
 
 	"istio.io/istio/pkg/kube"
 )
@@ -89,4 +90,17 @@ type Cluster interface {
 	// should route through the HTTP proxy or only Kubectl traffic. (Useful
 	// in topologies where the API server is private but the ingress is public).
 	ProxyKubectlOnly() bool
+
+	// PodExecf is PodExec with the command built from a format string and arguments (see
+	// FormatArgs). Each formatted argument is passed to the command as is, even if it contains
+	// spaces. A non-zero exit code of the command can be recovered from the error with ExitCode.
+	PodExecf(podName, podNamespace, container, format string, args ...any) (stdout, stderr string, err error)
+
+	// PodExecWithStdin is PodExec with the given input streamed to the command's stdin.
+	PodExecWithStdin(podName, podNamespace, container, command string, stdin io.Reader) (stdout, stderr string, err error)
+
+	// PodExecResult is PodExec, but a command that runs and exits with a non-zero code is not an
+	// error; its exit code is returned in the result. An error is only returned if the command
+	// could not be run.
+	PodExecResult(podName, podNamespace, container, command string) (ExecResult, error)
 }
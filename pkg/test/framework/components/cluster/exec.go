@@ -0,0 +1,225 @@
+//  Copyright Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"istio.io/istio/pkg/kube"
+)
+
+// DefaultExecConcurrency is the default number of concurrent execs made by PodExecParallel.
+const DefaultExecConcurrency = 10
+
+// PodRef identifies a pod in a cluster.
+type PodRef struct {
+	Cluster   Cluster
+	Namespace string
+	Name      string
+}
+
+func (p PodRef) String() string {
+	return fmt.Sprintf("%s/%s/%s", p.Cluster.Name(), p.Namespace, p.Name)
+}
+
+// ExecResult is the result of executing a command on a single pod.
+type ExecResult struct {
+	Pod    PodRef
+	Stdout string
+	Stderr string
+	// ExitCode of the command, or 0 if it succeeded or didn't run.
+	ExitCode int
+	// Err of the exec, including a non-zero exit code of the command, or nil if it succeeded.
+	Err error
+}
+
+// PodExecParallel executes the command in the given container of each pod, making at most
+// DefaultExecConcurrency execs at a time. See PodExecParallelWithConcurrency.
+func PodExecParallel(pods []PodRef, container, command string) ([]ExecResult, error) {
+	return PodExecParallelWithConcurrency(pods, container, command, DefaultExecConcurrency)
+}
+
+// PodExecParallelWithConcurrency executes the command in the given container of each pod, making
+// at most concurrency execs at a time. A result is returned for every pod, in the same order as
+// pods, even if some of the execs fail. The returned error lists the pods that failed.
+func PodExecParallelWithConcurrency(pods []PodRef, container, command string, concurrency int) ([]ExecResult, error) {
+	results := make([]ExecResult, len(pods))
+	g := errgroup.Group{}
+	if concurrency > 0 {
+		g.SetLimit(concurrency)
+	}
+	for i, pod := range pods {
+		g.Go(func() error {
+			res, err := pod.Cluster.PodExecResult(pod.Name, pod.Namespace, container, command)
+			res.Pod = pod
+			if res.Err == nil {
+				res.Err = err
+			}
+			results[i] = res
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	var errs error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("pod %s: %v", r.Pod, r.Err))
+		}
+	}
+	return results, errs
+}
+
+// ExecWithStdin executes the command in the given container of the pod, streaming stdin to the
+// command. It implements PodExecWithStdin for the clusters in this framework.
+func ExecWithStdin(c kube.CLIClient, podName, podNamespace, container, command string, stdin io.Reader) (string, string, error) {
+	stdout, stderr, err := PodExecArgs(context.Background(), c, podName, podNamespace, container, strings.Fields(command), stdin)
+	if err != nil {
+		err = fmt.Errorf("error exec'ing into %s/%s %s container: %v", podNamespace, podName, container, err)
+	}
+	return stdout, stderr, err
+}
+
+// ExecForResult executes the command in the given container of the pod, returning the exit code
+// of the command in the result. It implements PodExecResult for the clusters in this framework.
+func ExecForResult(c Cluster, podName, podNamespace, container, command string) (ExecResult, error) {
+	stdout, stderr, err := PodExecArgs(context.Background(), c, podName, podNamespace, container, strings.Fields(command), nil)
+	return execResult(PodRef{Cluster: c, Namespace: podNamespace, Name: podName}, container, stdout, stderr, err)
+}
+
+// execResult builds the result of an exec on the pod, with both the exit code and the error of the
+// exec set. An error that carries the exit code of the command is not returned, since the command
+// ran.
+func execResult(pod PodRef, container, stdout, stderr string, err error) (ExecResult, error) {
+	res := ExecResult{Pod: pod, Stdout: stdout, Stderr: stderr, Err: err}
+	if code, ok := ExitCode(err); ok {
+		res.ExitCode = code
+		return res, nil
+	}
+	if err != nil {
+		return res, fmt.Errorf("error exec'ing into %s/%s %s container: %v", pod.Namespace, pod.Name, container, err)
+	}
+	return res, nil
+}
+
+// ExitCode returns the exit code of a command that was run by PodExecArgs and exited with a
+// non-zero code. It returns false if the error is not from the command exiting, such as a failure
+// to reach the pod.
+func ExitCode(err error) (int, bool) {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// ExecFormatted executes the command built from the format string and arguments (see FormatArgs)
+// in the given container of the pod. It implements PodExecf for the clusters in this framework.
+// As with PodExecArgs, the exec is aborted if the context is cancelled, and the returned error is
+// not wrapped, so that a non-zero exit code can be recovered with ExitCode.
+func ExecFormatted(ctx context.Context, c kube.CLIClient, podName, podNamespace, container, format string, args ...any) (string, string, error) {
+	command, err := FormatArgs(format, args...)
+	if err != nil {
+		return "", "", err
+	}
+	return PodExecArgs(ctx, c, podName, podNamespace, container, command, nil)
+}
+
+// FormatArgs builds the arguments of a command from a format string and arguments. The format is
+// split into words on whitespace, and each word is formatted with fmt.Sprintf using the arguments
+// for its verbs. Formatted arguments are not split, so an argument with spaces, such as a header
+// value, stays a single argument of the command:
+//
+//	FormatArgs("curl -H %s %s", "Authorization: Bearer token", url)
+//
+// returns []string{"curl", "-H", "Authorization: Bearer token", url}. Verbs with a '*' width or
+// precision are not supported. An error is returned if the number of arguments doesn't match the
+// verbs of the format.
+func FormatArgs(format string, args ...any) ([]string, error) {
+	words := strings.Fields(format)
+	out := make([]string, 0, len(words))
+	next := 0
+	for _, w := range words {
+		n := countVerbs(w)
+		if next+n > len(args) {
+			return nil, fmt.Errorf("command format %q has more verbs than the %d arguments", format, len(args))
+		}
+		out = append(out, fmt.Sprintf(w, args[next:next+n]...))
+		next += n
+	}
+	if next != len(args) {
+		return nil, fmt.Errorf("command format %q has %d verbs for %d arguments", format, next, len(args))
+	}
+	return out, nil
+}
+
+// countVerbs returns the number of formatting verbs in s, not counting the "%%" escape.
+func countVerbs(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '%' {
+			i++
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// PodExecArgs executes the command, given as its arguments, in the given container of the pod,
+// streaming stdin to the command if it is not nil. Unlike Cluster.PodExec, the exec is aborted if
+// the context is cancelled, and arguments may contain spaces. The returned error is not wrapped,
+// so that a non-zero exit code can be recovered as a utilexec.ExitError.
+func PodExecArgs(ctx context.Context, c kube.CLIClient, podName, podNamespace, container string, command []string, stdin io.Reader) (string, string, error) {
+	req := c.Kube().CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(podNamespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(c.RESTConfig(), "POST", req.URL())
+	if err != nil {
+		return "", "", err
+	}
+	var stdout, stderr bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	return stdout.String(), stderr.String(), err
+}
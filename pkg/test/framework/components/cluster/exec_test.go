@@ -0,0 +1,192 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// execCluster is a fake cluster that runs PodExecResult with a function.
+type execCluster struct {
+	FakeCluster
+	exec func(podName, command string) (string, string, error)
+}
+
+func (c execCluster) PodExecResult(podName, podNamespace, container, command string) (ExecResult, error) {
+	stdout, stderr, err := c.exec(podName, command)
+	return execResult(PodRef{Cluster: c, Namespace: podNamespace, Name: podName}, container, stdout, stderr, err)
+}
+
+func TestPodExecParallel(t *testing.T) {
+	c := execCluster{
+		FakeCluster: FakeCluster{Topology: Topology{ClusterName: "cls1", ClusterKind: Fake}},
+		exec: func(podName, command string) (string, string, error) {
+			if podName == "b" {
+				return "", "boom", utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+			}
+			if podName == "c" {
+				return "", "", errors.New("dial tcp: connection refused")
+			}
+			return podName + ": " + command, "", nil
+		},
+	}
+	pods := []PodRef{
+		{Cluster: c, Namespace: "ns", Name: "a"},
+		{Cluster: c, Namespace: "ns", Name: "b"},
+		{Cluster: c, Namespace: "ns", Name: "c"},
+	}
+
+	results, err := PodExecParallel(pods, "istio-proxy", "echo hi")
+	if err == nil || !strings.Contains(err.Error(), "pod cls1/ns/b") || !strings.Contains(err.Error(), "pod cls1/ns/c") ||
+		strings.Contains(err.Error(), "pod cls1/ns/a") {
+		t.Fatalf("got error %v, want errors for pods b and c only", err)
+	}
+	if len(results) != len(pods) {
+		t.Fatalf("got %d results, want %d", len(results), len(pods))
+	}
+	for i, r := range results {
+		if r.Pod.Name != pods[i].Name {
+			t.Fatalf("result %d is for pod %s, want %s", i, r.Pod.Name, pods[i].Name)
+		}
+	}
+	if results[0].Stdout != "a: echo hi" || results[0].ExitCode != 0 || results[0].Err != nil {
+		t.Fatalf("unexpected result for pod a: %+v", results[0])
+	}
+	// The command ran on pod b and exited with a non-zero code.
+	if results[1].Stderr != "boom" || results[1].ExitCode != 1 || results[1].Err == nil {
+		t.Fatalf("unexpected result for pod b: %+v", results[1])
+	}
+	// The exec on pod c failed before the command ran.
+	if results[2].ExitCode != 0 || results[2].Err == nil {
+		t.Fatalf("unexpected result for pod c: %+v", results[2])
+	}
+}
+
+func TestPodExecParallelWithConcurrency(t *testing.T) {
+	var (
+		mu            sync.Mutex
+		running, peak int
+		concurrency   = 2
+		pods          []PodRef
+		podCount      = 6
+		execsPerPod   = map[string]int{}
+	)
+	c := execCluster{FakeCluster: FakeCluster{Topology: Topology{ClusterName: "cls1", ClusterKind: Fake}}}
+	c.exec = func(podName, _ string) (string, string, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		execsPerPod[podName]++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "", "", nil
+	}
+	for i := 0; i < podCount; i++ {
+		pods = append(pods, PodRef{Cluster: c, Namespace: "ns", Name: fmt.Sprintf("pod-%d", i)})
+	}
+
+	if _, err := PodExecParallelWithConcurrency(pods, "istio-proxy", "true", concurrency); err != nil {
+		t.Fatal(err)
+	}
+	if peak > concurrency {
+		t.Fatalf("got %d concurrent execs, want at most %d", peak, concurrency)
+	}
+	if len(execsPerPod) != podCount {
+		t.Fatalf("got execs on %d pods, want %d", len(execsPerPod), podCount)
+	}
+}
+
+func TestFormatArgs(t *testing.T) {
+	cases := []struct {
+		name    string
+		format  string
+		args    []any
+		want    []string
+		wantErr bool
+	}{
+		{name: "no verbs", format: "pilot-agent request GET stats", want: []string{"pilot-agent", "request", "GET", "stats"}},
+		{
+			name:   "argument with spaces",
+			format: "curl -H %s http://localhost:%d/%s",
+			args:   []any{"Authorization: Bearer token", 15000, "stats"},
+			want:   []string{"curl", "-H", "Authorization: Bearer token", "http://localhost:15000/stats"},
+		},
+		{name: "escaped percent", format: "echo 100%% %s", args: []any{"done"}, want: []string{"echo", "100%", "done"}},
+		{name: "missing argument", format: "echo %s %s", args: []any{"a"}, wantErr: true},
+		{name: "extra argument", format: "echo %s", args: []any{"a", "b"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FormatArgs(tc.format, tc.args...)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExecResult(t *testing.T) {
+	pod := PodRef{Namespace: "ns", Name: "a"}
+	cases := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantErr  bool
+	}{
+		{name: "success"},
+		{
+			name:     "command exited",
+			err:      utilexec.CodeExitError{Err: errors.New("command terminated with exit code 22"), Code: 22},
+			wantCode: 22,
+		},
+		{
+			name:     "wrapped command exit",
+			err:      fmt.Errorf("stream: %w", utilexec.CodeExitError{Err: errors.New("exit 3"), Code: 3}),
+			wantCode: 3,
+		},
+		{name: "exec failed", err: errors.New("dial tcp: connection refused"), wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := execResult(pod, "istio-proxy", "out", "err", tc.err)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tc.wantErr)
+			}
+			if res.ExitCode != tc.wantCode {
+				t.Fatalf("got exit code %d, want %d", res.ExitCode, tc.wantCode)
+			}
+			if res.Err != tc.err {
+				t.Fatalf("got result error %v, want %v", res.Err, tc.err)
+			}
+			if res.Pod.Name != pod.Name || res.Stdout != "out" || res.Stderr != "err" {
+				t.Fatalf("unexpected result: %+v", res)
+			}
+		})
+	}
+}
@@ -15,6 +15,9 @@
 package cluster
 
 import (
+	"context"
+	"io"
+
 	"k8s.io/apimachinery/pkg/version"
 
 	"istio.io/istio/pkg/kube"
@@ -65,3 +68,18 @@ type FakeCluster struct {
 func (f FakeCluster) GetKubernetesVersion() (*version.Info, error) {
 	return f.Version, nil
 }
+
+// PodExecf is PodExec with the command built from a format string and arguments.
+func (f FakeCluster) PodExecf(podName, podNamespace, container, format string, args ...any) (string, string, error) {
+	return ExecFormatted(context.Background(), f, podName, podNamespace, container, format, args...)
+}
+
+// PodExecWithStdin is PodExec with the given input streamed to the command's stdin.
+func (f FakeCluster) PodExecWithStdin(podName, podNamespace, container, command string, stdin io.Reader) (string, string, error) {
+	return ExecWithStdin(f, podName, podNamespace, container, command, stdin)
+}
+
+// PodExecResult is PodExec with the exit code of the command returned in the result.
+func (f FakeCluster) PodExecResult(podName, podNamespace, container, command string) (ExecResult, error) {
+	return ExecForResult(f, podName, podNamespace, container, command)
+}
@@ -16,7 +16,9 @@ package kube
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/test/framework/components/cluster"
@@ -62,6 +64,21 @@ func (c *Cluster) OverrideTopology(fn func(cluster.Topology) cluster.Topology) {
 	c.Topology = fn(c.Topology)
 }
 
+// PodExecResult is PodExec with the exit code of the command returned in the result.
+func (c *Cluster) PodExecResult(podName, podNamespace, container, command string) (cluster.ExecResult, error) {
+	return cluster.ExecForResult(c, podName, podNamespace, container, command)
+}
+
+// PodExecf is PodExec with the command built from a format string and arguments.
+func (c *Cluster) PodExecf(podName, podNamespace, container, format string, args ...any) (string, string, error) {
+	return cluster.ExecFormatted(context.Background(), c, podName, podNamespace, container, format, args...)
+}
+
+// PodExecWithStdin is PodExec with the given input streamed to the command's stdin.
+func (c *Cluster) PodExecWithStdin(podName, podNamespace, container, command string, stdin io.Reader) (string, string, error) {
+	return cluster.ExecWithStdin(c, podName, podNamespace, container, command, stdin)
+}
+
 func (c *Cluster) String() string {
 	buf := &bytes.Buffer{}
 
@@ -15,8 +15,10 @@
 package staticvm
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 
@@ -125,6 +127,21 @@ func (v vmcluster) CanDeploy(config echo.Config) (echo.Config, bool) {
 	return echo.Config{}, false
 }
 
+// PodExecResult is PodExec with the exit code of the command returned in the result.
+func (v vmcluster) PodExecResult(podName, podNamespace, container, command string) (cluster.ExecResult, error) {
+	return cluster.ExecForResult(v, podName, podNamespace, container, command)
+}
+
+// PodExecf is PodExec with the command built from a format string and arguments.
+func (v vmcluster) PodExecf(podName, podNamespace, container, format string, args ...any) (string, string, error) {
+	return cluster.ExecFormatted(context.Background(), v, podName, podNamespace, container, format, args...)
+}
+
+// PodExecWithStdin is PodExec with the given input streamed to the command's stdin.
+func (v vmcluster) PodExecWithStdin(podName, podNamespace, container, command string, stdin io.Reader) (string, string, error) {
+	return cluster.ExecWithStdin(v, podName, podNamespace, container, command, stdin)
+}
+
 func (v vmcluster) GetKubernetesVersion() (*version.Info, error) {
 	return nil, nil
 }
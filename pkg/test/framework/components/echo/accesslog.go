@@ -0,0 +1,155 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IstioAccessLogFormat is the Envoy format string of Istio's default text access log.
+const IstioAccessLogFormat = `[%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" ` +
+	`%RESPONSE_CODE% %RESPONSE_FLAGS% %RESPONSE_CODE_DETAILS% %CONNECTION_TERMINATION_DETAILS% ` +
+	`"%UPSTREAM_TRANSPORT_FAILURE_REASON%" %BYTES_RECEIVED% %BYTES_SENT% %DURATION% ` +
+	`%RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" ` +
+	`"%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%" %UPSTREAM_CLUSTER_RAW% %UPSTREAM_LOCAL_ADDRESS% ` +
+	`%DOWNSTREAM_LOCAL_ADDRESS% %DOWNSTREAM_REMOTE_ADDRESS% %REQUESTED_SERVER_NAME% %ROUTE_NAME%` + "\n"
+
+// AccessLogEntry is a single parsed access log line.
+type AccessLogEntry struct {
+	Method          string
+	Path            string
+	Protocol        string
+	ResponseCode    int
+	ResponseFlags   string
+	Duration        time.Duration
+	RequestID       string
+	Authority       string
+	UpstreamHost    string
+	UpstreamCluster string
+
+	// Fields holds the value of every command in the format, keyed by the command without the
+	// surrounding '%', e.g. "REQ(:METHOD)". Envoy logs unset values as "-".
+	Fields map[string]string
+}
+
+// AccessLogFormat parses access log lines written with a given Envoy format string.
+type AccessLogFormat struct {
+	pattern  *regexp.Regexp
+	commands []string
+}
+
+var accessLogCommand = regexp.MustCompile(`%([A-Z_]+(?:\([^)]*\))?(?::\d+)?)%`)
+
+// NewAccessLogFormat returns an AccessLogFormat for the given Envoy text format string. Commands
+// enclosed in double quotes may contain spaces; all other commands are expected not to.
+func NewAccessLogFormat(format string) (AccessLogFormat, error) {
+	format = strings.TrimSuffix(format, "\n")
+	var (
+		pattern  strings.Builder
+		commands []string
+		last     int
+	)
+	pattern.WriteString("^")
+	for _, m := range accessLogCommand.FindAllStringSubmatchIndex(format, -1) {
+		literal := format[last:m[0]]
+		pattern.WriteString(regexp.QuoteMeta(literal))
+		if strings.HasSuffix(literal, `"`) {
+			pattern.WriteString(`([^"]*)`)
+		} else {
+			pattern.WriteString(`(\S*)`)
+		}
+		commands = append(commands, format[m[2]:m[3]])
+		last = m[1]
+	}
+	if len(commands) == 0 {
+		return AccessLogFormat{}, fmt.Errorf("access log format %q has no commands", format)
+	}
+	pattern.WriteString(regexp.QuoteMeta(format[last:]))
+	pattern.WriteString("$")
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return AccessLogFormat{}, fmt.Errorf("invalid access log format %q: %v", format, err)
+	}
+	return AccessLogFormat{pattern: re, commands: commands}, nil
+}
+
+// DefaultAccessLogFormat returns the AccessLogFormat for Istio's default text access log.
+func DefaultAccessLogFormat() AccessLogFormat {
+	f, err := NewAccessLogFormat(IstioAccessLogFormat)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// ParseAccessLogs parses the access log lines in raw, such as the logs of a sidecar, that match the
+// format. Lines that don't match the format, such as Envoy's own logs, are skipped.
+func ParseAccessLogs(raw string, format AccessLogFormat) ([]AccessLogEntry, error) {
+	var out []AccessLogEntry
+	for _, line := range strings.Split(raw, "\n") {
+		m := format.pattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		e := AccessLogEntry{Fields: make(map[string]string, len(format.commands))}
+		for i, cmd := range format.commands {
+			e.Fields[cmd] = m[i+1]
+		}
+		if err := e.populate(); err != nil {
+			return nil, fmt.Errorf("failed parsing access log line %q: %v", line, err)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// populate sets the typed fields of the entry from the fields of well-known commands.
+func (e *AccessLogEntry) populate() error {
+	get := func(cmds ...string) string {
+		for _, c := range cmds {
+			if v, ok := e.Fields[c]; ok && v != "-" {
+				return v
+			}
+		}
+		return ""
+	}
+	e.Method = get("REQ(:METHOD)")
+	e.Path = get("REQ(X-ENVOY-ORIGINAL-PATH?:PATH)", "REQ(:PATH)")
+	e.Protocol = get("PROTOCOL")
+	e.ResponseFlags = get("RESPONSE_FLAGS")
+	e.RequestID = get("REQ(X-REQUEST-ID)")
+	e.Authority = get("REQ(:AUTHORITY)")
+	e.UpstreamHost = get("UPSTREAM_HOST")
+	e.UpstreamCluster = get("UPSTREAM_CLUSTER_RAW", "UPSTREAM_CLUSTER")
+	if v := get("RESPONSE_CODE"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid response code %q", v)
+		}
+		e.ResponseCode = code
+	}
+	if v := get("DURATION"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		e.Duration = time.Duration(ms) * time.Millisecond
+	}
+	return nil
+}
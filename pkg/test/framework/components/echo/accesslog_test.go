@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseAccessLogs(t *testing.T) {
+	raw := `2024-01-01T00:00:00.000000Z	info	Envoy proxy is ready
+[2024-01-01T00:00:01.000Z] "GET /status/418 HTTP/1.1" 418 - via_upstream - "-" 0 135 4 4 "-" "curl/7.73.0" "84961386-6d84" "httpbin:8000" "10.44.1.27:80" outbound|8000||httpbin.foo.svc.cluster.local 10.44.1.23:37652 10.0.45.184:8000 10.44.1.23:46520 - default
+[2024-01-01T00:00:02.000Z] "- - -" 0 UF,URX - - "-" 0 0 10001 - "-" "-" "-" "-" "10.44.1.28:443" outbound|443||b.foo.svc.cluster.local - 10.0.45.185:443 10.44.1.23:46521 b.foo.svc.cluster.local -
+`
+	got, err := ParseAccessLogs(raw, DefaultAccessLogFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AccessLogEntry{
+		{
+			Method:          "GET",
+			Path:            "/status/418",
+			Protocol:        "HTTP/1.1",
+			ResponseCode:    418,
+			Duration:        4 * time.Millisecond,
+			RequestID:       "84961386-6d84",
+			Authority:       "httpbin:8000",
+			UpstreamHost:    "10.44.1.27:80",
+			UpstreamCluster: "outbound|8000||httpbin.foo.svc.cluster.local",
+		},
+		{
+			ResponseFlags:   "UF,URX",
+			Duration:        10001 * time.Millisecond,
+			UpstreamHost:    "10.44.1.28:443",
+			UpstreamCluster: "outbound|443||b.foo.svc.cluster.local",
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(AccessLogEntry{}, "Fields")); diff != "" {
+		t.Fatalf("unexpected entries (-want +got):\n%s", diff)
+	}
+	if got[0].Fields["REQ(USER-AGENT)"] != "curl/7.73.0" {
+		t.Fatalf("unexpected user agent %q", got[0].Fields["REQ(USER-AGENT)"])
+	}
+}
+
+func TestParseAccessLogsCustomFormat(t *testing.T) {
+	format, err := NewAccessLogFormat(`%RESPONSE_CODE% %UPSTREAM_CLUSTER% "%REQ(:PATH)%"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseAccessLogs(`503 outbound|80||a "/with space"`, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ResponseCode != 503 || got[0].UpstreamCluster != "outbound|80||a" || got[0].Path != "/with space" {
+		t.Fatalf("unexpected entries %+v", got)
+	}
+
+	if _, err := NewAccessLogFormat("no commands"); err == nil {
+		t.Fatal("expected error for format without commands")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// EndpointStatus is the health of a cluster endpoint, as reported by the plaintext Envoy clusters
+// admin endpoint.
+type EndpointStatus struct {
+	// Cluster the endpoint belongs to.
+	Cluster string
+	// Address of the endpoint, as host:port.
+	Address string
+	// HealthFlags of the endpoint, e.g. "failed_outlier_check". Empty if the endpoint is healthy.
+	HealthFlags []string
+}
+
+// Healthy returns true if no health flags are set on the endpoint.
+func (e EndpointStatus) Healthy() bool {
+	return len(e.HealthFlags) == 0
+}
+
+// ParseClusterEndpoints parses the endpoint health from the output of the plaintext Envoy clusters
+// admin endpoint (i.e. Sidecar.ClustersText), in output order. Lines that don't report endpoint
+// health flags are ignored.
+func ParseClusterEndpoints(text string) []EndpointStatus {
+	var out []EndpointStatus
+	for _, line := range strings.Split(text, "\n") {
+		// Lines are formatted as <cluster>::<address>::<stat>::<value>. IPv6 addresses may contain
+		// "::", so the address is everything between the cluster and the stat.
+		parts := strings.Split(strings.TrimSpace(line), "::")
+		if len(parts) < 4 || parts[len(parts)-2] != "health_flags" {
+			continue
+		}
+		status := EndpointStatus{
+			Cluster: parts[0],
+			Address: strings.Join(parts[1:len(parts)-2], "::"),
+		}
+		if flags := parts[len(parts)-1]; flags != "healthy" {
+			status.HealthFlags = strings.Split(strings.TrimPrefix(flags, "/"), "/")
+		}
+		out = append(out, status)
+	}
+	return out
+}
+
+// ClusterEndpoint is an endpoint of a cluster, as reported by the JSON Envoy clusters admin endpoint.
+type ClusterEndpoint struct {
+	// Address of the endpoint, without the port.
+	Address string
+	Port    uint32
+	// Weight of the endpoint for load balancing.
+	Weight uint32
+
+	// Health of the endpoint as reported by EDS.
+	EDSHealth core.HealthStatus
+
+	// Health checking and outlier detection flags of the endpoint.
+	FailedActiveHealthCheck bool
+	FailedOutlierCheck      bool
+	PendingDynamicRemoval   bool
+	PendingActiveHC         bool
+}
+
+// Healthy returns true if the endpoint is healthy in EDS and no health check or outlier detection
+// has failed.
+func (e ClusterEndpoint) Healthy() bool {
+	if e.EDSHealth != core.HealthStatus_UNKNOWN && e.EDSHealth != core.HealthStatus_HEALTHY {
+		return false
+	}
+	return !e.FailedActiveHealthCheck && !e.FailedOutlierCheck && !e.PendingActiveHC
+}
+
+// HealthFlags returns the reasons the endpoint is unhealthy or being removed, using the flag names
+// of the plaintext Envoy clusters admin endpoint (e.g. "failed_outlier_check"). Returns nil if the
+// endpoint is healthy.
+func (e ClusterEndpoint) HealthFlags() []string {
+	var out []string
+	if e.EDSHealth != core.HealthStatus_UNKNOWN && e.EDSHealth != core.HealthStatus_HEALTHY {
+		out = append(out, "eds_status_"+strings.ToLower(e.EDSHealth.String()))
+	}
+	if e.FailedActiveHealthCheck {
+		out = append(out, "failed_active_hc")
+	}
+	if e.FailedOutlierCheck {
+		out = append(out, "failed_outlier_check")
+	}
+	if e.PendingDynamicRemoval {
+		out = append(out, "pending_dynamic_removal")
+	}
+	if e.PendingActiveHC {
+		out = append(out, "pending_active_hc")
+	}
+	return out
+}
+
+// FormatEndpoints returns a table of the address, weight and health flags of the endpoints, for
+// error messages.
+func FormatEndpoints(eps []ClusterEndpoint) string {
+	if len(eps) == 0 {
+		return "<no endpoints>"
+	}
+	sb := &strings.Builder{}
+	w := tabwriter.NewWriter(sb, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ADDRESS\tWEIGHT\tHEALTH")
+	for _, e := range eps {
+		health := "healthy"
+		if flags := e.HealthFlags(); len(flags) > 0 {
+			health = strings.Join(flags, ",")
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\n", net.JoinHostPort(e.Address, strconv.Itoa(int(e.Port))), e.Weight, health)
+	}
+	_ = w.Flush()
+	return sb.String()
+}
+
+// EndpointsForCluster returns the endpoints of the named cluster in the clusters admin response,
+// in response order. Returns nil if the cluster is not found.
+func EndpointsForCluster(clusters *admin.Clusters, name string) []ClusterEndpoint {
+	var out []ClusterEndpoint
+	for _, cs := range clusters.GetClusterStatuses() {
+		if cs.GetName() != name {
+			continue
+		}
+		for _, h := range cs.GetHostStatuses() {
+			health := h.GetHealthStatus()
+			out = append(out, ClusterEndpoint{
+				Address:                 h.GetAddress().GetSocketAddress().GetAddress(),
+				Port:                    h.GetAddress().GetSocketAddress().GetPortValue(),
+				Weight:                  h.GetWeight(),
+				EDSHealth:               health.GetEdsHealthStatus(),
+				FailedActiveHealthCheck: health.GetFailedActiveHealthCheck(),
+				FailedOutlierCheck:      health.GetFailedOutlierCheck(),
+				PendingDynamicRemoval:   health.GetPendingDynamicRemoval(),
+				PendingActiveHC:         health.GetPendingActiveHc(),
+			})
+		}
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"testing"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseClusterEndpoints(t *testing.T) {
+	text := `outbound|80||b.echo.svc.cluster.local::observability_name::outbound|80||b.echo.svc.cluster.local
+outbound|80||b.echo.svc.cluster.local::default_priority::max_connections::4294967295
+outbound|80||b.echo.svc.cluster.local::10.0.0.1:18080::cx_active::1
+outbound|80||b.echo.svc.cluster.local::10.0.0.1:18080::health_flags::healthy
+outbound|80||b.echo.svc.cluster.local::10.0.0.2:18080::health_flags::/failed_outlier_check
+outbound|80||b.echo.svc.cluster.local::10.0.0.3:18080::health_flags::/failed_active_hc/pending_dynamic_removal
+outbound|80||b.echo.svc.cluster.local::[fd00::1]:18080::health_flags::healthy
+`
+	want := []EndpointStatus{
+		{Cluster: "outbound|80||b.echo.svc.cluster.local", Address: "10.0.0.1:18080"},
+		{Cluster: "outbound|80||b.echo.svc.cluster.local", Address: "10.0.0.2:18080", HealthFlags: []string{"failed_outlier_check"}},
+		{
+			Cluster:     "outbound|80||b.echo.svc.cluster.local",
+			Address:     "10.0.0.3:18080",
+			HealthFlags: []string{"failed_active_hc", "pending_dynamic_removal"},
+		},
+		{Cluster: "outbound|80||b.echo.svc.cluster.local", Address: "[fd00::1]:18080"},
+	}
+	got := ParseClusterEndpoints(text)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected endpoints (-want +got):\n%s", diff)
+	}
+	if !got[0].Healthy() || got[1].Healthy() {
+		t.Fatalf("unexpected health: %v, %v", got[0].Healthy(), got[1].Healthy())
+	}
+}
+
+func TestEndpointsForCluster(t *testing.T) {
+	host := func(ip string, weight uint32, health *admin.HostHealthStatus) *admin.HostStatus {
+		return &admin.HostStatus{
+			Address: &core.Address{Address: &core.Address_SocketAddress{SocketAddress: &core.SocketAddress{
+				Address:       ip,
+				PortSpecifier: &core.SocketAddress_PortValue{PortValue: 8080},
+			}}},
+			Weight:       weight,
+			HealthStatus: health,
+		}
+	}
+	clusters := &admin.Clusters{ClusterStatuses: []*admin.ClusterStatus{
+		{Name: "other", HostStatuses: []*admin.HostStatus{host("10.0.0.9", 1, nil)}},
+		{Name: "inbound|8080||", HostStatuses: []*admin.HostStatus{
+			host("10.0.0.1", 1, &admin.HostHealthStatus{EdsHealthStatus: core.HealthStatus_HEALTHY}),
+			host("10.0.0.2", 2, &admin.HostHealthStatus{FailedOutlierCheck: true}),
+			host("10.0.0.3", 1, &admin.HostHealthStatus{EdsHealthStatus: core.HealthStatus_DRAINING}),
+		}},
+	}}
+	got := EndpointsForCluster(clusters, "inbound|8080||")
+	want := []ClusterEndpoint{
+		{Address: "10.0.0.1", Port: 8080, Weight: 1, EDSHealth: core.HealthStatus_HEALTHY},
+		{Address: "10.0.0.2", Port: 8080, Weight: 2, FailedOutlierCheck: true},
+		{Address: "10.0.0.3", Port: 8080, Weight: 1, EDSHealth: core.HealthStatus_DRAINING},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected endpoints (-want +got):\n%s", diff)
+	}
+	var healthy []bool
+	for _, e := range got {
+		healthy = append(healthy, e.Healthy())
+	}
+	if diff := cmp.Diff([]bool{true, false, false}, healthy); diff != "" {
+		t.Fatalf("unexpected health (-want +got):\n%s", diff)
+	}
+	if got := EndpointsForCluster(clusters, "missing"); got != nil {
+		t.Fatalf("expected no endpoints, got %v", got)
+	}
+}
+
+func TestFormatEndpoints(t *testing.T) {
+	got := FormatEndpoints([]ClusterEndpoint{
+		{Address: "10.0.0.1", Port: 8080, Weight: 1, EDSHealth: core.HealthStatus_HEALTHY},
+		{Address: "10.0.0.2", Port: 8080, Weight: 2, FailedOutlierCheck: true, PendingDynamicRemoval: true},
+		{Address: "fd00::1", Port: 8080, Weight: 1, EDSHealth: core.HealthStatus_DRAINING},
+	})
+	want := `ADDRESS         WEIGHT  HEALTH
+10.0.0.1:8080   1       healthy
+10.0.0.2:8080   2       failed_outlier_check,pending_dynamic_removal
+[fd00::1]:8080  1       eds_status_draining
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected table (-want +got):\n%s", diff)
+	}
+	if got := FormatEndpoints(nil); got != "<no endpoints>" {
+		t.Fatalf("unexpected table for no endpoints: %q", got)
+	}
+}
@@ -456,6 +456,9 @@ func New(ctx resource.Context, cfg Config) (*Echos, error) {
 		apps.NS[i].Namespace = ns.Get()
 	}
 	if !cfg.NoExternalNamespace {
+		if err := apps.External.validate(); err != nil {
+			return nil, fmt.Errorf("invalid external deployment: %v", err)
+		}
 		apps.External.Namespace = cfg.ExternalNamespace.Get()
 	}
 
@@ -465,7 +468,18 @@ func New(ctx resource.Context, cfg Config) (*Echos, error) {
 	}
 
 	if !cfg.NoExternalNamespace {
-		builder = apps.External.build(ctx, builder)
+		if len(apps.External.EgressNamespaces) == 0 {
+			for _, n := range apps.NS {
+				apps.External.EgressNamespaces = append(apps.External.EgressNamespaces, n.Namespace)
+			}
+		}
+		if err := apps.External.applyEgressSidecar(ctx); err != nil {
+			return nil, err
+		}
+		var err error
+		if builder, err = apps.External.build(ctx, builder); err != nil {
+			return nil, err
+		}
 	}
 
 	echos, err := builder.Build()
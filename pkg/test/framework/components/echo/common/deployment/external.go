@@ -15,8 +15,21 @@
 package deployment
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"istio.io/istio/pkg/test/echo/common"
 	"istio.io/istio/pkg/test/env"
@@ -27,6 +40,7 @@ import (
 	"istio.io/istio/pkg/test/framework/components/namespace"
 	"istio.io/istio/pkg/test/framework/resource"
 	"istio.io/istio/pkg/test/util/file"
+	"istio.io/istio/pkg/util/sets"
 )
 
 const (
@@ -40,43 +54,518 @@ type External struct {
 
 	// All external echo instances with no sidecar injected
 	All echo.Instances
+
+	// ServiceNameOverride, if set, is the name of the external service. Defaults to ExternalSvc.
+	ServiceNameOverride string
+
+	// HostnameOverride, if set, is the hostname of the external service. Defaults to
+	// ExternalHostname. When set, the served certificate is generated for this hostname (see CertCN).
+	HostnameOverride string
+
+	// DelayedPathLatency is the distribution of response delays sampled by DelayedPath. The echo
+	// server has no server-wide latency setting: it only delays a response when the request asks
+	// for it with a "delay" query parameter. Calls to the external service are therefore delayed
+	// only when their path is built with DelayedPath. Defaults to no added latency.
+	DelayedPathLatency LatencyDistribution
+
+	// Versions of the external service to deploy, each as a separate subset without a sidecar.
+	// Defaults to a single "v1" version.
+	Versions []string
+
+	// Annotations are added to the annotations of each subset of the external service. The sidecar
+	// is not injected unless Annotations overrides echo.SidecarInject.
+	Annotations map[echo.Annotation]*echo.AnnotationValue
+
+	// Plaintext, if true, makes the external service listen without TLS: the ports that serve TLS
+	// (HTTPS and AutoHTTPS) are not deployed. By default, it serves TLS with the certificate
+	// described by CertCN.
+	Plaintext bool
+
+	// CertCN is the subject common name of the certificate served by the external service. If either
+	// CertCN or CertSANs is set, a self-signed certificate with these identities is generated at deploy
+	// time. Otherwise, the certificate baked into the echo image, with SAN server.default.svc, is used.
+	CertCN string
+
+	// CertSANs are the subject alternative names (DNS names or IP addresses) of the certificate served
+	// by the external service. See CertCN.
+	CertSANs []string
+
+	// RootCert, ClientCert and Key, if set, are the PEM encoded certificate material served by the
+	// external service, instead of a baked-in or generated certificate. ClientCert and Key must be
+	// set together. If RootCert is not set, ClientCert is used as the root. The certificate should
+	// be valid for the Hostname of the service.
+	RootCert   string
+	ClientCert string
+	Key        string
+
+	// SANHosts are additional hostnames that the external service serves over TLS, modeling a
+	// shared endpoint fronting several logical services. The echo server presents a single
+	// certificate whatever the SNI of the connection, so the hosts can't have certificates of their
+	// own. Instead, when set, a certificate is generated (see CertCN) with each host added to its
+	// DNS SANs, making the one certificate valid for all of them.
+	SANHosts []string
+
+	// IPFamilies, if set, are the IP families of the external service (e.g. "IPv6"), overriding the
+	// dual-stack families used when the test settings enable dual stack.
+	IPFamilies string
+
+	// IPFamilyPolicy, if set, is the IP family policy of the external service (e.g. "SingleStack").
+	// Like IPFamilies, it takes precedence over the dual-stack default.
+	IPFamilyPolicy string
+
+	// Image, if set, pins the image of the external echo server, e.g. to reproduce a regression
+	// against an older echo server. Defaults to the echo image of the test settings.
+	Image string
+
+	// ImagePullPolicy, if set, is the pull policy of the Image. Defaults to the pull policy of the
+	// test settings.
+	ImagePullPolicy string
+
+	// StartupDelay delays the readiness probe of the external workload, keeping its endpoints
+	// not-ready for at least this long after the pod starts. Defaults to immediate readiness.
+	StartupDelay time.Duration
+
+	// EgressHosts, if set, are applied as the egress hosts of a Sidecar resource in each of the
+	// EgressNamespaces, limiting the egress of the client workloads there. Each host must be in the
+	// "namespace/dnsName" format.
+	EgressHosts []string
+
+	// EgressNamespaces are the namespaces of the client workloads whose egress is limited to
+	// EgressHosts. The Sidecar resource has no workload selector, so it applies to every injected
+	// workload in these namespaces. It is not applied in the external namespace, which only holds
+	// the uninjected external workloads. When deployed by New, defaults to the echo namespaces of
+	// the deployment.
+	EgressNamespaces []namespace.Instance
+
+	// byVersion are the instances of All restricted to the workloads of each version. Populated by
+	// loadValues.
+	byVersion map[string]echo.Instances
 }
 
-func (e External) build(t resource.Context, b deployment.Builder) deployment.Builder {
-	config := echo.Config{
-		Service:           ExternalSvc,
-		Namespace:         e.Namespace,
-		DefaultHostHeader: ExternalHostname,
-		Ports:             ports.All(),
-		// Set up TLS certs on the server. This will make the server listen with these credentials.
-		TLSSettings: &common.TLSSettings{
-			// Echo has these test certs baked into the docker image
-			RootCert:   file.MustAsString(path.Join(env.IstioSrc, "tests/testdata/certs/dns/root-cert.pem")),
-			ClientCert: file.MustAsString(path.Join(env.IstioSrc, "tests/testdata/certs/dns/cert-chain.pem")),
-			Key:        file.MustAsString(path.Join(env.IstioSrc, "tests/testdata/certs/dns/key.pem")),
+// LatencyDistribution maps a percentile in the range (0, 100] to the response delay at that
+// percentile. For example, {50: 10ms, 99: 200ms, 100: time.Second}. The distribution must
+// include the 100th percentile and delays must not decrease as the percentile increases.
+type LatencyDistribution map[float64]time.Duration
+
+func (d LatencyDistribution) percentiles() []float64 {
+	out := make([]float64, 0, len(d))
+	for p := range d {
+		out = append(out, p)
+	}
+	sort.Float64s(out)
+	return out
+}
+
+// Validate checks that the distribution is well formed.
+func (d LatencyDistribution) Validate() error {
+	if len(d) == 0 {
+		return nil
+	}
+	var prev time.Duration
+	percentiles := d.percentiles()
+	for _, p := range percentiles {
+		delay := d[p]
+		if p <= 0 || p > 100 {
+			return fmt.Errorf("invalid latency percentile %v: must be in the range (0, 100]", p)
+		}
+		if delay < 0 {
+			return fmt.Errorf("invalid latency at percentile %v: %v is negative", p, delay)
+		}
+		if delay < prev {
+			return fmt.Errorf("invalid latency at percentile %v: %v is less than the delay at a lower percentile (%v)", p, delay, prev)
+		}
+		prev = delay
+	}
+	if percentiles[len(percentiles)-1] != 100 {
+		return fmt.Errorf("latency distribution must include the 100th percentile")
+	}
+	return nil
+}
+
+// Sample returns a random delay drawn from the distribution, or zero if the distribution is empty.
+func (d LatencyDistribution) Sample() time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	r := rand.Float64() * 100 // nolint: gosec // test only code
+	percentiles := d.percentiles()
+	for _, p := range percentiles {
+		if r < p {
+			return d[p]
+		}
+	}
+	return d[percentiles[len(percentiles)-1]]
+}
+
+// DelayedPath returns the given HTTP request path with a response delay sampled from
+// DelayedPathLatency, passed as the "delay" query parameter. The echo server waits for the delay
+// before responding. A new delay is sampled on each call, so build the path per request.
+func (e External) DelayedPath(p string) string {
+	delay := e.DelayedPathLatency.Sample()
+	if delay == 0 {
+		return p
+	}
+	sep := "?"
+	if strings.Contains(p, "?") {
+		sep = "&"
+	}
+	return p + sep + "delay=" + delay.String()
+}
+
+// ServiceName returns the name of the external service.
+func (e External) ServiceName() string {
+	if e.ServiceNameOverride != "" {
+		return e.ServiceNameOverride
+	}
+	return ExternalSvc
+}
+
+// Hostname returns the hostname of the external service.
+func (e External) Hostname() string {
+	if e.HostnameOverride != "" {
+		return e.HostnameOverride
+	}
+	return ExternalHostname
+}
+
+func (e External) validate() error {
+	if err := e.DelayedPathLatency.Validate(); err != nil {
+		return err
+	}
+	for _, h := range e.EgressHosts {
+		ns, host, ok := strings.Cut(h, "/")
+		if !ok || ns == "" || host == "" || strings.Contains(host, "/") {
+			return fmt.Errorf("invalid egress host %q: must be in the format namespace/dnsName", h)
+		}
+	}
+	versions := sets.New[string]()
+	for _, v := range e.Versions {
+		if v == "" {
+			return fmt.Errorf("invalid external version: must not be empty")
+		}
+		if versions.InsertContains(v) {
+			return fmt.Errorf("duplicate external version %q", v)
+		}
+	}
+	hasCertMaterial := e.RootCert != "" || e.ClientCert != "" || e.Key != ""
+	if e.Plaintext && (e.CertCN != "" || len(e.CertSANs) > 0 || len(e.SANHosts) > 0 || hasCertMaterial) {
+		return fmt.Errorf("certificate settings can't be used with a plaintext external service")
+	}
+	if hasCertMaterial {
+		if e.ClientCert == "" || e.Key == "" {
+			return fmt.Errorf("external certificate and key must be set together")
+		}
+		if e.CertCN != "" || len(e.CertSANs) > 0 || len(e.SANHosts) > 0 {
+			return fmt.Errorf("external certificate material can't be used with CertCN, CertSANs or SANHosts")
+		}
+	}
+	seen := sets.New[string]()
+	for _, h := range e.SANHosts {
+		if h == "" || net.ParseIP(h) != nil {
+			return fmt.Errorf("invalid SAN host %q: must be a DNS name", h)
+		}
+		if seen.InsertContains(h) {
+			return fmt.Errorf("duplicate SAN host %q", h)
+		}
+	}
+	return nil
+}
+
+// applyEgressSidecar applies a Sidecar resource limiting egress to the EgressHosts in each of the
+// EgressNamespaces. The resources are removed when the context is cleaned up.
+func (e External) applyEgressSidecar(t resource.Context) error {
+	if len(e.EgressHosts) == 0 {
+		return nil
+	}
+	for _, ns := range e.EgressNamespaces {
+		if err := t.ConfigIstio().Eval(ns.Name(), map[string]any{
+			"Hosts": e.EgressHosts,
+		}, `apiVersion: networking.istio.io/v1alpha3
+kind: Sidecar
+metadata:
+  name: external-egress
+spec:
+  egress:
+  - hosts:
+{{- range .Hosts }}
+    - "{{ . }}"
+{{- end }}
+`).Apply(); err != nil {
+			return fmt.Errorf("failed applying egress Sidecar in namespace %s: %v", ns.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (e External) tlsSettings() (*common.TLSSettings, error) {
+	if e.ClientCert != "" {
+		root := e.RootCert
+		if root == "" {
+			root = e.ClientCert
+		}
+		return &common.TLSSettings{
+			RootCert:   root,
+			ClientCert: e.ClientCert,
+			Key:        e.Key,
+			Hostname:   e.Hostname(),
+		}, nil
+	}
+	if e.CertCN == "" && len(e.CertSANs) == 0 && len(e.SANHosts) == 0 && e.HostnameOverride == "" {
+		// Echo has these test certs baked into the docker image
+		var certs [3]string
+		for i, name := range []string{"root-cert.pem", "cert-chain.pem", "key.pem"} {
+			p := path.Join(env.IstioSrc, "tests/testdata/certs/dns", name)
+			content, err := file.AsString(p)
+			if err != nil {
+				return nil, fmt.Errorf("external deployment requires certs at %s; set IstioSrc or the External cert fields: %v", p, err)
+			}
+			certs[i] = content
+		}
+		return &common.TLSSettings{
+			RootCert:   certs[0],
+			ClientCert: certs[1],
+			Key:        certs[2],
 			// Override hostname to match the SAN in the cert we are using
 			// TODO(nmittler): We should probably make this the same as ExternalHostname
 			Hostname: "server.default.svc",
-		},
-		Subsets: []echo.SubsetConfig{
-			{
-				Version: "v1",
-				Annotations: map[echo.Annotation]*echo.AnnotationValue{
-					echo.SidecarInject: {
-						Value: strconv.FormatBool(false),
-					},
-				},
+		}, nil
+	}
+
+	var sans []string
+	if e.HostnameOverride != "" {
+		sans = append(sans, e.HostnameOverride)
+	}
+	sans = append(append(sans, e.CertSANs...), e.SANHosts...)
+	cert, key, err := generateSelfSignedCert(e.CertCN, sans)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating certificate for external deployment: %v", err)
+	}
+	hostname := e.CertCN
+	if len(sans) > 0 {
+		hostname = sans[0]
+	}
+	return &common.TLSSettings{
+		RootCert:   cert,
+		ClientCert: cert,
+		Key:        key,
+		Hostname:   hostname,
+	}, nil
+}
+
+// generateSelfSignedCert generates a PEM encoded self-signed certificate and key with the given
+// common name and subject alternative names.
+func generateSelfSignedCert(cn string, sans []string) (string, string, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := cryptorand.Int(cryptorand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Istio Test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, san)
+		}
+	}
+	der, err := x509.CreateCertificate(cryptorand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		return "", "", err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return "", "", err
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(cert), string(key), nil
+}
+
+func (e External) build(t resource.Context, b deployment.Builder) (deployment.Builder, error) {
+	var tls *common.TLSSettings
+	if !e.Plaintext {
+		var err error
+		if tls, err = e.tlsSettings(); err != nil {
+			return nil, err
+		}
+	}
+	return b.WithConfig(e.config(t.Settings().EnableDualStack, tls)), nil
+}
+
+// config returns the echo config of the external service, serving the given TLS settings. The
+// settings are ignored if the service is plaintext. If dualStack is set, the service is dual-stack
+// unless the IP families are set explicitly.
+func (e External) config(dualStack bool, tls *common.TLSSettings) echo.Config {
+	config := echo.Config{
+		Service:               e.ServiceName(),
+		Namespace:             e.Namespace,
+		DefaultHostHeader:     e.Hostname(),
+		Ports:                 e.ports(),
+		ReadinessInitialDelay: e.StartupDelay,
+		Image:                 e.Image,
+		ImagePullPolicy:       e.ImagePullPolicy,
+	}
+	versions := e.Versions
+	if len(versions) == 0 {
+		versions = []string{"v1"}
+	}
+	for _, v := range versions {
+		annotations := map[echo.Annotation]*echo.AnnotationValue{
+			echo.SidecarInject: {
+				Value: strconv.FormatBool(false),
 			},
-		},
+		}
+		for k, val := range e.Annotations {
+			annotations[k] = &echo.AnnotationValue{Value: val.Value}
+		}
+		config.Subsets = append(config.Subsets, echo.SubsetConfig{
+			Version:     v,
+			Annotations: annotations,
+		})
 	}
-	if t.Settings().EnableDualStack {
+	if !e.Plaintext {
+		// Set up TLS certs on the server. This will make the server listen with these credentials.
+		config.TLSSettings = tls
+	}
+	if e.IPFamilies != "" || e.IPFamilyPolicy != "" {
+		config.IPFamilies = e.IPFamilies
+		config.IPFamilyPolicy = e.IPFamilyPolicy
+	} else if dualStack {
 		config.IPFamilies = "IPv6, IPv4"
 		config.IPFamilyPolicy = "RequireDualStack"
 	}
-	return b.WithConfig(config)
+	return config
+}
+
+// ports returns the ports of the external service. A plaintext service has no TLS ports, since
+// the echo server would serve them with its built-in certificate.
+func (e External) ports() echo.Ports {
+	all := ports.All()
+	if !e.Plaintext {
+		return all
+	}
+	out := make(echo.Ports, 0, len(all))
+	for _, p := range all {
+		if !p.TLS {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// GetByVersion returns the external echo instances restricted to the workloads of the given
+// version, as of when the deployment was loaded. Returns an empty (non-nil) list if the version was
+// not deployed.
+func (e External) GetByVersion(version string) echo.Instances {
+	if out := e.byVersion[version]; out != nil {
+		return out
+	}
+	return echo.Instances{}
 }
 
 func (e *External) loadValues(echos echo.Instances) error {
-	e.All = match.ServiceName(echo.NamespacedName{Name: ExternalSvc, Namespace: e.Namespace}).GetMatches(echos)
+	e.All = match.ServiceName(echo.NamespacedName{Name: e.ServiceName(), Namespace: e.Namespace}).GetMatches(echos)
+	e.byVersion = map[string]echo.Instances{}
+	for _, inst := range e.All {
+		ws, err := inst.Workloads()
+		if err != nil {
+			return fmt.Errorf("failed getting workloads of %s: %v", inst.Config().Service, err)
+		}
+		// Each version is a subset of the instance, deployed with its version label.
+		byVersion := map[string]echo.Workloads{}
+		for _, w := range ws {
+			v := w.Labels()["version"]
+			byVersion[v] = append(byVersion[v], w)
+		}
+		for v, vws := range byVersion {
+			e.byVersion[v] = append(e.byVersion[v], inst.WithWorkloads(vws...))
+		}
+	}
+	return nil
+}
+
+// ExternalSet deploys the same external service into each of several namespaces, for tests that
+// need an isolated external service per namespace. The TLS and port configuration of External is
+// shared by all namespaces; in particular, a generated certificate is generated once.
+type ExternalSet struct {
+	// Namespaces to deploy the external service into.
+	Namespaces []namespace.Instance
+
+	// External is the configuration of the external service. Its Namespace is ignored.
+	External External
+
+	// All external echo instances, keyed by namespace name. Populated by LoadValues.
+	All map[string]echo.Instances
+}
+
+func (s ExternalSet) validate() error {
+	if len(s.Namespaces) == 0 {
+		return fmt.Errorf("external set requires at least one namespace")
+	}
+	names := sets.New[string]()
+	for _, ns := range s.Namespaces {
+		if names.InsertContains(ns.Name()) {
+			return fmt.Errorf("duplicate external set namespace %q", ns.Name())
+		}
+	}
+	if len(s.External.EgressHosts) > 0 && len(s.External.EgressNamespaces) == 0 {
+		return fmt.Errorf("external set egress hosts require EgressNamespaces to apply them to")
+	}
+	return s.External.validate()
+}
+
+// forNamespace returns the External deployed into the given namespace.
+func (s ExternalSet) forNamespace(ns namespace.Instance) External {
+	e := s.External
+	e.Namespace = ns
+	return e
+}
+
+// Build validates the set and adds the config of the external service in each namespace to the
+// builder. If External has EgressHosts, the egress Sidecar is applied in each of its
+// EgressNamespaces, which must be set.
+func (s ExternalSet) Build(t resource.Context, b deployment.Builder) (deployment.Builder, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	var tls *common.TLSSettings
+	if !s.External.Plaintext {
+		var err error
+		if tls, err = s.External.tlsSettings(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.External.applyEgressSidecar(t); err != nil {
+		return nil, err
+	}
+	for _, ns := range s.Namespaces {
+		b = b.WithConfig(s.forNamespace(ns).config(t.Settings().EnableDualStack, tls))
+	}
+	return b, nil
+}
+
+// LoadValues populates All with the external echo instances of each namespace, from the instances
+// built by the builder passed to Build.
+func (s *ExternalSet) LoadValues(echos echo.Instances) error {
+	s.All = make(map[string]echo.Instances, len(s.Namespaces))
+	for _, ns := range s.Namespaces {
+		e := s.forNamespace(ns)
+		if err := e.loadValues(echos); err != nil {
+			return err
+		}
+		s.All[ns.Name()] = e.All
+	}
 	return nil
 }
@@ -0,0 +1,480 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/test/echo/common"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/components/echo/common/ports"
+	"istio.io/istio/pkg/test/framework/components/namespace"
+)
+
+func TestLatencyDistributionValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		d       LatencyDistribution
+		wantErr string
+	}{
+		{name: "empty"},
+		{name: "valid", d: LatencyDistribution{50: time.Millisecond, 99: 10 * time.Millisecond, 100: time.Second}},
+		{name: "zero percentile", d: LatencyDistribution{0: time.Millisecond, 100: time.Second}, wantErr: "invalid latency percentile 0"},
+		{name: "percentile over 100", d: LatencyDistribution{100: time.Millisecond, 101: time.Second}, wantErr: "invalid latency percentile 101"},
+		{name: "negative delay", d: LatencyDistribution{100: -time.Millisecond}, wantErr: "is negative"},
+		{name: "decreasing delay", d: LatencyDistribution{50: time.Second, 100: time.Millisecond}, wantErr: "less than the delay at a lower percentile"},
+		{name: "missing 100th percentile", d: LatencyDistribution{50: time.Millisecond}, wantErr: "must include the 100th percentile"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkError(t, tc.d.Validate(), tc.wantErr)
+		})
+	}
+}
+
+func TestLatencyDistributionSample(t *testing.T) {
+	if got := (LatencyDistribution{}).Sample(); got != 0 {
+		t.Fatalf("got delay %v from an empty distribution, want 0", got)
+	}
+	d := LatencyDistribution{50: time.Millisecond, 100: time.Second}
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		got := d.Sample()
+		if got != time.Millisecond && got != time.Second {
+			t.Fatalf("got delay %v, want one of the distribution's delays", got)
+		}
+		seen[got] = true
+	}
+	if len(seen) != 2 {
+		t.Fatalf("got delays %v in 1000 samples, want both delays", seen)
+	}
+}
+
+func TestExternalDelayedPath(t *testing.T) {
+	cases := []struct {
+		name    string
+		latency LatencyDistribution
+		path    string
+		want    string
+	}{
+		{name: "no latency", path: "/a", want: "/a"},
+		{name: "path", latency: LatencyDistribution{100: 10 * time.Millisecond}, path: "/a", want: "/a?delay=10ms"},
+		{name: "path with query", latency: LatencyDistribution{100: time.Second}, path: "/a?b=c", want: "/a?b=c&delay=1s"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := (External{DelayedPathLatency: tc.latency}).DelayedPath(tc.path); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExternalValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		external External
+		wantErr  string
+	}{
+		{name: "default"},
+		{name: "invalid latency", external: External{DelayedPathLatency: LatencyDistribution{50: 0}}, wantErr: "100th percentile"},
+		{name: "egress host", external: External{EgressHosts: []string{"istio-system/*", "./fake.external.com"}}},
+		{name: "egress host without namespace", external: External{EgressHosts: []string{"fake.external.com"}}, wantErr: "invalid egress host"},
+		{name: "egress host with empty host", external: External{EgressHosts: []string{"ns/"}}, wantErr: "invalid egress host"},
+		{name: "egress host with path", external: External{EgressHosts: []string{"ns/a/b"}}, wantErr: "invalid egress host"},
+		{name: "versions", external: External{Versions: []string{"v1", "v2"}}},
+		{name: "empty version", external: External{Versions: []string{""}}, wantErr: "must not be empty"},
+		{name: "duplicate version", external: External{Versions: []string{"v1", "v1"}}, wantErr: `duplicate external version "v1"`},
+		{name: "plaintext with cert CN", external: External{Plaintext: true, CertCN: "a"}, wantErr: "plaintext"},
+		{name: "plaintext with SAN hosts", external: External{Plaintext: true, SANHosts: []string{"a.com"}}, wantErr: "plaintext"},
+		{name: "plaintext with cert material", external: External{Plaintext: true, ClientCert: "c", Key: "k"}, wantErr: "plaintext"},
+		{name: "cert material", external: External{RootCert: "r", ClientCert: "c", Key: "k"}},
+		{name: "cert without key", external: External{ClientCert: "c"}, wantErr: "must be set together"},
+		{name: "root cert only", external: External{RootCert: "r"}, wantErr: "must be set together"},
+		{name: "cert material with CN", external: External{ClientCert: "c", Key: "k", CertCN: "a"}, wantErr: "can't be used with CertCN"},
+		{name: "cert material with SANs", external: External{ClientCert: "c", Key: "k", CertSANs: []string{"a"}}, wantErr: "can't be used with CertCN"},
+		{name: "SAN hosts", external: External{SANHosts: []string{"a.com", "b.com"}}},
+		{name: "empty SAN host", external: External{SANHosts: []string{""}}, wantErr: "must be a DNS name"},
+		{name: "IP SAN host", external: External{SANHosts: []string{"10.0.0.1"}}, wantErr: "must be a DNS name"},
+		{name: "duplicate SAN host", external: External{SANHosts: []string{"a.com", "a.com"}}, wantErr: `duplicate SAN host "a.com"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkError(t, tc.external.validate(), tc.wantErr)
+		})
+	}
+}
+
+func TestExternalTLSSettings(t *testing.T) {
+	t.Run("client cert as root", func(t *testing.T) {
+		tls, err := External{ClientCert: "cert", Key: "key", HostnameOverride: "a.com"}.tlsSettings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tls.RootCert != "cert" || tls.ClientCert != "cert" || tls.Key != "key" || tls.Hostname != "a.com" {
+			t.Fatalf("unexpected TLS settings: %+v", tls)
+		}
+	})
+
+	t.Run("root cert", func(t *testing.T) {
+		tls, err := External{RootCert: "root", ClientCert: "cert", Key: "key"}.tlsSettings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tls.RootCert != "root" || tls.Hostname != ExternalHostname {
+			t.Fatalf("unexpected TLS settings: %+v", tls)
+		}
+	})
+
+	cases := []struct {
+		name         string
+		external     External
+		wantCN       string
+		wantDNS      []string
+		wantIPs      []string
+		wantHostname string
+	}{
+		{
+			name:         "common name only",
+			external:     External{CertCN: "external"},
+			wantCN:       "external",
+			wantHostname: "external",
+		},
+		{
+			name: "SANs",
+			external: External{
+				HostnameOverride: "h.com",
+				CertCN:           "external",
+				CertSANs:         []string{"a.com", "10.0.0.1"},
+				SANHosts:         []string{"b.com", "c.com"},
+			},
+			wantCN:       "external",
+			wantDNS:      []string{"h.com", "a.com", "b.com", "c.com"},
+			wantIPs:      []string{"10.0.0.1"},
+			wantHostname: "h.com",
+		},
+		{
+			name:         "SAN hosts only",
+			external:     External{SANHosts: []string{"b.com"}},
+			wantDNS:      []string{"b.com"},
+			wantHostname: "b.com",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tls, err := tc.external.tlsSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tls.RootCert != tls.ClientCert {
+				t.Fatal("expected the self-signed certificate to be its own root")
+			}
+			if tls.Hostname != tc.wantHostname {
+				t.Fatalf("got hostname %q, want %q", tls.Hostname, tc.wantHostname)
+			}
+			block, _ := pem.Decode([]byte(tls.ClientCert))
+			if block == nil {
+				t.Fatal("failed decoding the generated certificate")
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ips []string
+			for _, ip := range cert.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+			if cert.Subject.CommonName != tc.wantCN || !reflect.DeepEqual(cert.DNSNames, tc.wantDNS) || !reflect.DeepEqual(ips, tc.wantIPs) {
+				t.Fatalf("got certificate for CN %q, DNS %v, IPs %v, want CN %q, DNS %v, IPs %v",
+					cert.Subject.CommonName, cert.DNSNames, ips, tc.wantCN, tc.wantDNS, tc.wantIPs)
+			}
+			if block, _ := pem.Decode([]byte(tls.Key)); block == nil {
+				t.Fatal("failed decoding the generated key")
+			}
+		})
+	}
+}
+
+func TestExternalConfig(t *testing.T) {
+	tls := &common.TLSSettings{Hostname: "a.com"}
+	cases := []struct {
+		name      string
+		external  External
+		dualStack bool
+		check     func(t *testing.T, cfg echo.Config)
+	}{
+		{
+			name: "default",
+			check: func(t *testing.T, cfg echo.Config) {
+				if cfg.Service != ExternalSvc || cfg.DefaultHostHeader != ExternalHostname || cfg.TLSSettings != tls {
+					t.Fatalf("unexpected config: service %q, host %q, TLS %v", cfg.Service, cfg.DefaultHostHeader, cfg.TLSSettings)
+				}
+				if len(cfg.Subsets) != 1 || cfg.Subsets[0].Version != "v1" {
+					t.Fatalf("got subsets %+v, want a single v1 subset", cfg.Subsets)
+				}
+				if v := cfg.Subsets[0].Annotations[echo.SidecarInject]; v == nil || v.Value != "false" {
+					t.Fatalf("got sidecar inject annotation %v, want false", v)
+				}
+				if cfg.IPFamilies != "" || cfg.IPFamilyPolicy != "" {
+					t.Fatalf("got IP families %q (%q), want none", cfg.IPFamilies, cfg.IPFamilyPolicy)
+				}
+			},
+		},
+		{
+			name:     "overrides",
+			external: External{ServiceNameOverride: "svc", HostnameOverride: "svc.example.com", Image: "echo:old", ImagePullPolicy: "Never"},
+			check: func(t *testing.T, cfg echo.Config) {
+				if cfg.Service != "svc" || cfg.DefaultHostHeader != "svc.example.com" || cfg.Image != "echo:old" || cfg.ImagePullPolicy != "Never" {
+					t.Fatalf("unexpected config: service %q, host %q, image %q (%q)", cfg.Service, cfg.DefaultHostHeader, cfg.Image, cfg.ImagePullPolicy)
+				}
+			},
+		},
+		{
+			name: "versions and annotations",
+			external: External{
+				Versions: []string{"v1", "v2"},
+				Annotations: map[echo.Annotation]*echo.AnnotationValue{
+					echo.SidecarInject:           {Value: "true"},
+					echo.SidecarInterceptionMode: {Value: "TPROXY"},
+				},
+			},
+			check: func(t *testing.T, cfg echo.Config) {
+				var versions []string
+				for _, s := range cfg.Subsets {
+					versions = append(versions, s.Version)
+					if v := s.Annotations[echo.SidecarInject]; v == nil || v.Value != "true" {
+						t.Fatalf("subset %s: got sidecar inject annotation %v, want the override", s.Version, v)
+					}
+					if v := s.Annotations[echo.SidecarInterceptionMode]; v == nil || v.Value != "TPROXY" {
+						t.Fatalf("subset %s: got interception mode annotation %v, want TPROXY", s.Version, v)
+					}
+				}
+				if !reflect.DeepEqual(versions, []string{"v1", "v2"}) {
+					t.Fatalf("got subset versions %v, want [v1 v2]", versions)
+				}
+				// Subsets don't share annotation values.
+				if cfg.Subsets[0].Annotations[echo.SidecarInject] == cfg.Subsets[1].Annotations[echo.SidecarInject] {
+					t.Fatal("expected each subset to have its own annotation values")
+				}
+			},
+		},
+		{
+			name:     "plaintext",
+			external: External{Plaintext: true},
+			check: func(t *testing.T, cfg echo.Config) {
+				if cfg.TLSSettings != nil {
+					t.Fatalf("got TLS settings %v for a plaintext service", cfg.TLSSettings)
+				}
+			},
+		},
+		{
+			name:      "dual stack",
+			dualStack: true,
+			check: func(t *testing.T, cfg echo.Config) {
+				if cfg.IPFamilies != "IPv6, IPv4" || cfg.IPFamilyPolicy != "RequireDualStack" {
+					t.Fatalf("got IP families %q (%q), want dual stack", cfg.IPFamilies, cfg.IPFamilyPolicy)
+				}
+			},
+		},
+		{
+			name:      "IP families override dual stack",
+			external:  External{IPFamilies: "IPv6", IPFamilyPolicy: "SingleStack"},
+			dualStack: true,
+			check: func(t *testing.T, cfg echo.Config) {
+				if cfg.IPFamilies != "IPv6" || cfg.IPFamilyPolicy != "SingleStack" {
+					t.Fatalf("got IP families %q (%q), want IPv6 (SingleStack)", cfg.IPFamilies, cfg.IPFamilyPolicy)
+				}
+			},
+		},
+		{
+			name:     "startup delay",
+			external: External{StartupDelay: 5 * time.Second},
+			check: func(t *testing.T, cfg echo.Config) {
+				if cfg.ReadinessInitialDelay != 5*time.Second {
+					t.Fatalf("got readiness delay %v, want 5s", cfg.ReadinessInitialDelay)
+				}
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.check(t, tc.external.config(tc.dualStack, tls))
+		})
+	}
+}
+
+func TestExternalSetValidate(t *testing.T) {
+	a, b := namespace.Static("a"), namespace.Static("b")
+	cases := []struct {
+		name    string
+		set     ExternalSet
+		wantErr string
+	}{
+		{name: "valid", set: ExternalSet{Namespaces: []namespace.Instance{a, b}}},
+		{name: "no namespaces", wantErr: "at least one namespace"},
+		{name: "duplicate namespace", set: ExternalSet{Namespaces: []namespace.Instance{a, a}}, wantErr: `duplicate external set namespace "a"`},
+		{
+			name: "egress hosts",
+			set: ExternalSet{
+				Namespaces: []namespace.Instance{a},
+				External:   External{EgressHosts: []string{"./fake.external.com"}, EgressNamespaces: []namespace.Instance{b}},
+			},
+		},
+		{
+			name:    "egress hosts without namespaces",
+			set:     ExternalSet{Namespaces: []namespace.Instance{a}, External: External{EgressHosts: []string{"./fake.external.com"}}},
+			wantErr: "require EgressNamespaces",
+		},
+		{
+			name:    "invalid external",
+			set:     ExternalSet{Namespaces: []namespace.Instance{a}, External: External{Versions: []string{"v1", "v1"}}},
+			wantErr: "duplicate external version",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkError(t, tc.set.validate(), tc.wantErr)
+		})
+	}
+}
+
+// checkError fails the test unless err contains wantErr, or is nil if wantErr is empty.
+func checkError(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	if wantErr == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("got error %v, want an error containing %q", err, wantErr)
+	}
+}
+
+func TestExternalPorts(t *testing.T) {
+	cases := []struct {
+		name      string
+		external  External
+		wantTLS   bool
+		wantCount int
+	}{
+		{name: "tls", external: External{}, wantTLS: true, wantCount: len(ports.All())},
+		{name: "plaintext", external: External{Plaintext: true}, wantTLS: false, wantCount: len(ports.All()) - 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.external.config(false, nil)
+			if len(cfg.Ports) != tc.wantCount {
+				t.Fatalf("got %d ports, want %d", len(cfg.Ports), tc.wantCount)
+			}
+			_, hasHTTPS := cfg.Ports.ForName(ports.HTTPS.Name)
+			_, hasAutoHTTPS := cfg.Ports.ForName(ports.AutoHTTPS.Name)
+			if hasHTTPS != tc.wantTLS || hasAutoHTTPS != tc.wantTLS {
+				t.Fatalf("got https port %v, auto-https port %v, want %v", hasHTTPS, hasAutoHTTPS, tc.wantTLS)
+			}
+			for _, p := range cfg.Ports {
+				if p.TLS && !tc.wantTLS {
+					t.Fatalf("plaintext service has TLS port %s", p.Name)
+				}
+			}
+		})
+	}
+}
+
+// fakeInstance is an echo instance with the given config and workloads. Only the methods used to
+// load the values of External are implemented.
+type fakeInstance struct {
+	echo.Instance
+	config    echo.Config
+	workloads echo.Workloads
+}
+
+func (i fakeInstance) Config() echo.Config {
+	return i.config
+}
+
+func (i fakeInstance) NamespacedName() echo.NamespacedName {
+	return i.config.NamespacedName()
+}
+
+func (i fakeInstance) Workloads() (echo.Workloads, error) {
+	return i.workloads, nil
+}
+
+func (i fakeInstance) WithWorkloads(wls ...echo.Workload) echo.Instance {
+	i.workloads = wls
+	return i
+}
+
+// fakeWorkload is a workload of the given pod with the given version label.
+type fakeWorkload struct {
+	echo.Workload
+	pod     string
+	version string
+}
+
+func (w fakeWorkload) PodName() string {
+	return w.pod
+}
+
+func (w fakeWorkload) Labels() map[string]string {
+	return map[string]string{"version": w.version}
+}
+
+func TestExternalGetByVersion(t *testing.T) {
+	ns := namespace.Static("external")
+	e := External{Namespace: ns, Versions: []string{"v1", "v2"}}
+	external := fakeInstance{
+		config: echo.Config{Service: ExternalSvc, Namespace: ns},
+		workloads: echo.Workloads{
+			fakeWorkload{pod: "external-v1-a", version: "v1"},
+			fakeWorkload{pod: "external-v2-a", version: "v2"},
+			fakeWorkload{pod: "external-v2-b", version: "v2"},
+		},
+	}
+	other := fakeInstance{config: echo.Config{Service: "a", Namespace: ns}}
+	if err := e.loadValues(echo.Instances{external, other}); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.All) != 1 {
+		t.Fatalf("got %d external instances, want 1", len(e.All))
+	}
+
+	pods := func(instances echo.Instances) []string {
+		var out []string
+		for _, inst := range instances {
+			ws, _ := inst.Workloads()
+			for _, w := range ws {
+				out = append(out, w.PodName())
+			}
+		}
+		return out
+	}
+	if got, want := pods(e.GetByVersion("v1")), []string{"external-v1-a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("v1: got pods %v, want %v", got, want)
+	}
+	if got, want := pods(e.GetByVersion("v2")), []string{"external-v2-a", "external-v2-b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("v2: got pods %v, want %v", got, want)
+	}
+	if got := e.GetByVersion("v3"); got == nil || len(got) != 0 {
+		t.Fatalf("v3: got %v, want an empty non-nil list", got)
+	}
+}
@@ -137,7 +137,7 @@ spec:
 	if !t.Settings().DisableDefaultExternalServiceConnectivity {
 		// Create a ServiceEntry to allow apps in this namespace to talk to the external service.
 		if d.External.Namespace != nil {
-			DeployExternalServiceEntry(cfg, ns, d.External.Namespace)
+			deployExternalServiceEntry(cfg, ns, d.External)
 		}
 	}
 
@@ -145,9 +145,14 @@ spec:
 }
 
 func DeployExternalServiceEntry(cfg config.Factory, deployedNamespace, externalNamespace namespace.Instance) config.Plan {
+	return deployExternalServiceEntry(cfg, deployedNamespace, External{Namespace: externalNamespace})
+}
+
+func deployExternalServiceEntry(cfg config.Factory, deployedNamespace namespace.Instance, external External) config.Plan {
 	return cfg.Eval(deployedNamespace.Name(), map[string]any{
-		"Namespace": externalNamespace.Name(),
-		"Hostname":  ExternalHostname,
+		"Namespace": external.Namespace.Name(),
+		"Service":   external.ServiceName(),
+		"Hostname":  external.Hostname(),
 		"Ports":     serviceEntryPorts(),
 	}, `apiVersion: networking.istio.io/v1alpha3
 kind: ServiceEntry
@@ -160,7 +165,7 @@ spec:
   location: MESH_EXTERNAL
   resolution: DNS
   endpoints:
-  - address: external.{{.Namespace}}.svc.cluster.local
+  - address: {{.Service}}.{{.Namespace}}.svc.cluster.local
   ports:
   - name: http-tls-origination
     number: 8888
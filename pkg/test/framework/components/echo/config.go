@@ -134,6 +134,10 @@ type Config struct {
 	// ReadinessGRPCPort if set, use this port for the GRPC readiness probe (instead of using a HTTP probe).
 	ReadinessGRPCPort string
 
+	// ReadinessInitialDelay if set, delays the first readiness probe by this duration, rounded up
+	// to the nearest second.
+	ReadinessInitialDelay time.Duration
+
 	// Subsets contains the list of Subsets config belonging to this echo
 	// service instance.
 	Subsets []SubsetConfig
@@ -144,6 +148,14 @@ type Config struct {
 	// TLS settings for echo server
 	TLSSettings *common.TLSSettings
 
+	// Image, if set, is the full path of the image of the echo application container of Kubernetes
+	// deployments, overriding the echo image of the test settings.
+	Image string
+
+	// ImagePullPolicy, if set, is the pull policy of the echo application container, overriding the
+	// pull policy of the test settings.
+	ImagePullPolicy string
+
 	// If enabled, echo will be deployed as a "VM". This means it will run Envoy in the same pod as echo,
 	// disable sidecar injection, etc.
 	// This aims to simulate a VM, but instead of managing the complex test setup of spinning up a VM,
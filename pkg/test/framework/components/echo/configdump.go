@@ -0,0 +1,780 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	compressor "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/compressor/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	upstreamhttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	"github.com/pmezard/go-difflib/difflib"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"istio.io/istio/pkg/util/sets"
+)
+
+// RouteConfigurations returns all static and dynamic route configurations in the config dump.
+func RouteConfigurations(cfg *admin.ConfigDump) ([]*route.RouteConfiguration, error) {
+	var out []*route.RouteConfiguration
+	for _, c := range cfg.GetConfigs() {
+		if !c.MessageIs(&admin.RoutesConfigDump{}) {
+			continue
+		}
+		dump := &admin.RoutesConfigDump{}
+		if err := c.UnmarshalTo(dump); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling routes config dump: %v", err)
+		}
+		var anys []*anypb.Any
+		for _, r := range dump.GetStaticRouteConfigs() {
+			anys = append(anys, r.GetRouteConfig())
+		}
+		for _, r := range dump.GetDynamicRouteConfigs() {
+			anys = append(anys, r.GetRouteConfig())
+		}
+		for _, a := range anys {
+			rc := &route.RouteConfiguration{}
+			if err := a.UnmarshalTo(rc); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling route configuration: %v", err)
+			}
+			out = append(out, rc)
+		}
+	}
+	return out, nil
+}
+
+// ClusterConfigurations returns all static and active dynamic clusters in the config dump.
+func ClusterConfigurations(cfg *admin.ConfigDump) ([]*envoycluster.Cluster, error) {
+	var out []*envoycluster.Cluster
+	for _, c := range cfg.GetConfigs() {
+		if !c.MessageIs(&admin.ClustersConfigDump{}) {
+			continue
+		}
+		dump := &admin.ClustersConfigDump{}
+		if err := c.UnmarshalTo(dump); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling clusters config dump: %v", err)
+		}
+		var anys []*anypb.Any
+		for _, cl := range dump.GetStaticClusters() {
+			anys = append(anys, cl.GetCluster())
+		}
+		for _, cl := range dump.GetDynamicActiveClusters() {
+			anys = append(anys, cl.GetCluster())
+		}
+		for _, a := range anys {
+			cl := &envoycluster.Cluster{}
+			if err := a.UnmarshalTo(cl); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling cluster: %v", err)
+			}
+			out = append(out, cl)
+		}
+	}
+	return out, nil
+}
+
+// FindCluster returns the cluster with the given name from the config dump. The name may either be
+// a full cluster name (e.g. "outbound|80||foo.ns.svc.cluster.local") or the FQDN of a service, in
+// which case the outbound cluster for that host without a subset is returned. Subset clusters are
+// never selected by FQDN. If the service has clusters for more than one port, the FQDN is
+// ambiguous and an error is returned; pass the full cluster name instead.
+func FindCluster(cfg *admin.ConfigDump, name string) (*envoycluster.Cluster, error) {
+	clusters, err := ClusterConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clusters {
+		if c.GetName() == name {
+			return c, nil
+		}
+	}
+	var matches []*envoycluster.Cluster
+	for _, c := range clusters {
+		parts := strings.Split(c.GetName(), "|")
+		if len(parts) == 4 && parts[0] == "outbound" && parts[2] == "" && parts[3] == name {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("cluster %s not found in Envoy config", name)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, 0, len(matches))
+		for _, c := range matches {
+			names = append(names, c.GetName())
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("host %s matches clusters for more than one port %v, pass the full cluster name", name, names)
+	}
+}
+
+const httpProtocolOptionsKey = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+
+// httpProtocolOptions returns the HTTP protocol options for the cluster. If the cluster doesn't set
+// them in its typed extension protocol options, they are built from the deprecated cluster-level
+// protocol options fields. Returns nil if the cluster has no HTTP protocol options.
+func httpProtocolOptions(c *envoycluster.Cluster) (*upstreamhttp.HttpProtocolOptions, error) {
+	if a, ok := c.GetTypedExtensionProtocolOptions()[httpProtocolOptionsKey]; ok {
+		opts := &upstreamhttp.HttpProtocolOptions{}
+		if err := a.UnmarshalTo(opts); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling HTTP protocol options for cluster %s: %v", c.GetName(), err)
+		}
+		return opts, nil
+	}
+
+	// nolint: staticcheck
+	common, h1, h2 := c.GetCommonHttpProtocolOptions(), c.GetHttpProtocolOptions(), c.GetHttp2ProtocolOptions()
+	if common == nil && h1 == nil && h2 == nil {
+		return nil, nil
+	}
+	opts := &upstreamhttp.HttpProtocolOptions{CommonHttpProtocolOptions: common}
+	explicit := &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig{}
+	if h2 != nil {
+		explicit.ProtocolConfig = &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{Http2ProtocolOptions: h2}
+	} else if h1 != nil {
+		explicit.ProtocolConfig = &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_HttpProtocolOptions{HttpProtocolOptions: h1}
+	}
+	if explicit.ProtocolConfig != nil {
+		opts.UpstreamProtocolOptions = &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_{ExplicitHttpConfig: explicit}
+	}
+	return opts, nil
+}
+
+// HTTPConnectionPool returns the HTTP protocol options of the cluster in the config dump with the
+// given FQDN or name (see FindCluster), or nil if it has none. See Sidecar.HTTPConnectionPool.
+func HTTPConnectionPool(cfg *admin.ConfigDump, fqdn string) (*upstreamhttp.HttpProtocolOptions, error) {
+	c, err := FindCluster(cfg, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return httpProtocolOptions(c)
+}
+
+// HealthChecks returns the active health checks of the cluster in the config dump with the given
+// FQDN or name. See Sidecar.HealthChecks.
+func HealthChecks(cfg *admin.ConfigDump, fqdn string) ([]*core.HealthCheck, error) {
+	c, err := FindCluster(cfg, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*core.HealthCheck{}, c.GetHealthChecks()...), nil
+}
+
+// LoadBalancerPolicy returns the load balancing policy of the cluster in the config dump with the
+// given FQDN or name. See Sidecar.LoadBalancerPolicy.
+func LoadBalancerPolicy(cfg *admin.ConfigDump, fqdn string) (envoycluster.Cluster_LbPolicy, error) {
+	c, err := FindCluster(cfg, fqdn)
+	if err != nil {
+		return envoycluster.Cluster_ROUND_ROBIN, err
+	}
+	return c.GetLbPolicy(), nil
+}
+
+// LoadBalancerHash is the consistent hash load balancing config of a cluster, as returned by
+// Sidecar.LoadBalancerHash.
+type LoadBalancerHash struct {
+	// RingHash is the config of a RING_HASH cluster, or nil.
+	RingHash *envoycluster.Cluster_RingHashLbConfig
+	// Maglev is the config of a MAGLEV cluster, or nil.
+	Maglev *envoycluster.Cluster_MaglevLbConfig
+	// HashPolicies of the routes to the cluster, which select what is hashed for a request. Route
+	// configurations are searched in name order, and duplicate policies are dropped.
+	HashPolicies []*route.RouteAction_HashPolicy
+}
+
+// LoadBalancerHashConfig returns the consistent hash config of the cluster in the config dump with
+// the given FQDN or name, and the hash policies of the routes to it. See Sidecar.LoadBalancerHash.
+func LoadBalancerHashConfig(cfg *admin.ConfigDump, fqdn string) (*LoadBalancerHash, error) {
+	c, err := FindCluster(cfg, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	rcs, err := RouteConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rcs, func(i, j int) bool {
+		return rcs[i].GetName() < rcs[j].GetName()
+	})
+
+	out := &LoadBalancerHash{RingHash: c.GetRingHashLbConfig(), Maglev: c.GetMaglevLbConfig()}
+	for _, rc := range rcs {
+		for _, vh := range rc.GetVirtualHosts() {
+			for _, r := range vh.GetRoutes() {
+				if !slices.Contains(routeClusters(r), c.GetName()) {
+					continue
+				}
+				for _, hp := range r.GetRoute().GetHashPolicy() {
+					if !slices.ContainsFunc(out.HashPolicies, func(p *route.RouteAction_HashPolicy) bool {
+						return proto.Equal(p, hp)
+					}) {
+						out.HashPolicies = append(out.HashPolicies, hp)
+					}
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// UpstreamTLSSANs returns the SANs verified by the upstream TLS context of the cluster in the
+// config dump with the given FQDN or name. See Sidecar.UpstreamTLSSANs.
+func UpstreamTLSSANs(cfg *admin.ConfigDump, fqdn string) ([]string, error) {
+	c, err := FindCluster(cfg, fqdn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, err := upstreamTLSContext(c)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		return nil, fmt.Errorf("cluster %s has no upstream TLS context", c.GetName())
+	}
+	return subjectAltNames(ctx), nil
+}
+
+// IsMutualTLS returns true if the cluster in the config dump with the given FQDN or name
+// originates mutual TLS. See Sidecar.IsMutualTLS.
+func IsMutualTLS(cfg *admin.ConfigDump, fqdn string) (bool, error) {
+	c, err := FindCluster(cfg, fqdn)
+	if err != nil {
+		return false, err
+	}
+	return isMutualTLS(c)
+}
+
+// ListenerConfigurations returns all static and active dynamic listeners in the config dump.
+func ListenerConfigurations(cfg *admin.ConfigDump) ([]*listener.Listener, error) {
+	var out []*listener.Listener
+	for _, c := range cfg.GetConfigs() {
+		if !c.MessageIs(&admin.ListenersConfigDump{}) {
+			continue
+		}
+		dump := &admin.ListenersConfigDump{}
+		if err := c.UnmarshalTo(dump); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling listeners config dump: %v", err)
+		}
+		var anys []*anypb.Any
+		for _, l := range dump.GetStaticListeners() {
+			anys = append(anys, l.GetListener())
+		}
+		for _, l := range dump.GetDynamicListeners() {
+			if active := l.GetActiveState(); active != nil {
+				anys = append(anys, active.GetListener())
+			}
+		}
+		for _, a := range anys {
+			l := &listener.Listener{}
+			if err := a.UnmarshalTo(l); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling listener: %v", err)
+			}
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// EndpointConfigurations returns the static and dynamic load assignments in the config dump,
+// keyed by cluster name. Dynamic endpoints are only in config dumps that include EDS (i.e.
+// config_dump?include_eds).
+func EndpointConfigurations(cfg *admin.ConfigDump) (map[string]*endpoint.ClusterLoadAssignment, error) {
+	out := map[string]*endpoint.ClusterLoadAssignment{}
+	for _, c := range cfg.GetConfigs() {
+		if !c.MessageIs(&admin.EndpointsConfigDump{}) {
+			continue
+		}
+		dump := &admin.EndpointsConfigDump{}
+		if err := c.UnmarshalTo(dump); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling endpoints config dump: %v", err)
+		}
+		var anys []*anypb.Any
+		for _, e := range dump.GetStaticEndpointConfigs() {
+			anys = append(anys, e.GetEndpointConfig())
+		}
+		for _, e := range dump.GetDynamicEndpointConfigs() {
+			anys = append(anys, e.GetEndpointConfig())
+		}
+		for _, a := range anys {
+			cla := &endpoint.ClusterLoadAssignment{}
+			if err := a.UnmarshalTo(cla); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling cluster load assignment: %v", err)
+			}
+			out[cla.GetClusterName()] = cla
+		}
+	}
+	return out, nil
+}
+
+// BootstrapConfigDump returns the bootstrap config dump from the config dump.
+func BootstrapConfigDump(cfg *admin.ConfigDump) (*admin.BootstrapConfigDump, error) {
+	for _, c := range cfg.GetConfigs() {
+		if !c.MessageIs(&admin.BootstrapConfigDump{}) {
+			continue
+		}
+		dump := &admin.BootstrapConfigDump{}
+		if err := c.UnmarshalTo(dump); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling bootstrap config dump: %v", err)
+		}
+		return dump, nil
+	}
+	return nil, fmt.Errorf("bootstrap config not found in Envoy config")
+}
+
+// SecretsConfigDump returns the secrets config dump from the config dump, or an empty one if the
+// config dump has no secrets.
+func SecretsConfigDump(cfg *admin.ConfigDump) (*admin.SecretsConfigDump, error) {
+	for _, c := range cfg.GetConfigs() {
+		if !c.MessageIs(&admin.SecretsConfigDump{}) {
+			continue
+		}
+		dump := &admin.SecretsConfigDump{}
+		if err := c.UnmarshalTo(dump); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling secrets config dump: %v", err)
+		}
+		return dump, nil
+	}
+	return &admin.SecretsConfigDump{}, nil
+}
+
+// upstreamTLSContext returns the upstream TLS context of the cluster's transport socket. If the
+// cluster only configures TLS through transport socket matches (e.g. for auto mTLS), the first TLS
+// context among them is returned. Returns nil if the cluster has no TLS context.
+func upstreamTLSContext(c *envoycluster.Cluster) (*tls.UpstreamTlsContext, error) {
+	sockets := []*core.TransportSocket{c.GetTransportSocket()}
+	for _, m := range c.GetTransportSocketMatches() {
+		sockets = append(sockets, m.GetTransportSocket())
+	}
+	for _, ts := range sockets {
+		a := ts.GetTypedConfig()
+		if a == nil || !a.MessageIs(&tls.UpstreamTlsContext{}) {
+			continue
+		}
+		ctx := &tls.UpstreamTlsContext{}
+		if err := a.UnmarshalTo(ctx); err != nil {
+			return nil, fmt.Errorf("failed unmarshalling upstream TLS context for cluster %s: %v", c.GetName(), err)
+		}
+		return ctx, nil
+	}
+	return nil, nil
+}
+
+// isMutualTLS returns true if the cluster's transport socket, or any of its transport socket
+// matches, is TLS with a client certificate.
+func isMutualTLS(c *envoycluster.Cluster) (bool, error) {
+	sockets := []*core.TransportSocket{c.GetTransportSocket()}
+	for _, m := range c.GetTransportSocketMatches() {
+		sockets = append(sockets, m.GetTransportSocket())
+	}
+	for _, ts := range sockets {
+		a := ts.GetTypedConfig()
+		if a == nil || !a.MessageIs(&tls.UpstreamTlsContext{}) {
+			continue
+		}
+		ctx := &tls.UpstreamTlsContext{}
+		if err := a.UnmarshalTo(ctx); err != nil {
+			return false, fmt.Errorf("failed unmarshalling upstream TLS context for cluster %s: %v", c.GetName(), err)
+		}
+		common := ctx.GetCommonTlsContext()
+		if len(common.GetTlsCertificates()) > 0 || len(common.GetTlsCertificateSdsSecretConfigs()) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// subjectAltNames returns the SANs verified by the TLS context, from both the typed and the
+// deprecated untyped SAN matchers.
+func subjectAltNames(ctx *tls.UpstreamTlsContext) []string {
+	common := ctx.GetCommonTlsContext()
+	vc := common.GetValidationContext()
+	if vc == nil {
+		vc = common.GetCombinedValidationContext().GetDefaultValidationContext()
+	}
+	out := make([]string, 0)
+	for _, m := range vc.GetMatchTypedSubjectAltNames() {
+		out = append(out, stringMatcherValue(m.GetMatcher()))
+	}
+	// nolint: staticcheck
+	for _, m := range vc.GetMatchSubjectAltNames() {
+		out = append(out, stringMatcherValue(m))
+	}
+	return out
+}
+
+// stringMatcherValue returns the pattern of the string matcher, regardless of its match type.
+func stringMatcherValue(m *matcher.StringMatcher) string {
+	switch p := m.GetMatchPattern().(type) {
+	case *matcher.StringMatcher_Exact:
+		return p.Exact
+	case *matcher.StringMatcher_Prefix:
+		return p.Prefix
+	case *matcher.StringMatcher_Suffix:
+		return p.Suffix
+	case *matcher.StringMatcher_Contains:
+		return p.Contains
+	case *matcher.StringMatcher_SafeRegex:
+		return p.SafeRegex.GetRegex()
+	default:
+		return ""
+	}
+}
+
+// Names of the listeners that Istio uses to capture redirected traffic.
+const (
+	virtualOutboundListenerName = "virtualOutbound"
+	virtualInboundListenerName  = "virtualInbound"
+)
+
+// summarizeListeners counts the listeners by type. The virtual listeners used to capture
+// redirected traffic are counted separately from the inbound and outbound listeners.
+func summarizeListeners(listeners []*listener.Listener) (inbound, outbound, virtual int) {
+	for _, l := range listeners {
+		switch {
+		case l.GetName() == virtualOutboundListenerName || l.GetName() == virtualInboundListenerName:
+			virtual++
+		case l.GetTrafficDirection() == core.TrafficDirection_INBOUND || strings.HasPrefix(l.GetName(), "inbound|"):
+			inbound++
+		default:
+			outbound++
+		}
+	}
+	return inbound, outbound, virtual
+}
+
+// httpFilters returns the HTTP filters of all HTTP connection managers in the listener's filter
+// chains, including the default filter chain.
+func httpFilters(l *listener.Listener) ([]*hcm.HttpFilter, error) {
+	chains := append([]*listener.FilterChain{}, l.GetFilterChains()...)
+	if l.GetDefaultFilterChain() != nil {
+		chains = append(chains, l.GetDefaultFilterChain())
+	}
+	var out []*hcm.HttpFilter
+	for _, fc := range chains {
+		for _, f := range fc.GetFilters() {
+			a := f.GetTypedConfig()
+			if a == nil || !a.MessageIs(&hcm.HttpConnectionManager{}) {
+				continue
+			}
+			m := &hcm.HttpConnectionManager{}
+			if err := a.UnmarshalTo(m); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling HTTP connection manager in listener %s: %v", l.GetName(), err)
+			}
+			out = append(out, m.GetHttpFilters()...)
+		}
+	}
+	return out, nil
+}
+
+// listenersForPatchContext returns the listeners that an EnvoyFilter patch with the given context
+// (ANY, SIDECAR_INBOUND, SIDECAR_OUTBOUND or GATEWAY) applies to. As in Istio, the SIDECAR contexts
+// only apply to sidecars and GATEWAY only to gateways, so the other contexts select no listeners.
+func listenersForPatchContext(listeners []*listener.Listener, patchContext string, gateway bool) ([]*listener.Listener, error) {
+	inbound := func(l *listener.Listener) bool {
+		return l.GetName() == virtualInboundListenerName ||
+			l.GetTrafficDirection() == core.TrafficDirection_INBOUND || strings.HasPrefix(l.GetName(), "inbound|")
+	}
+	var keep func(*listener.Listener) bool
+	switch patchContext {
+	case "ANY":
+		keep = func(*listener.Listener) bool { return true }
+	case "GATEWAY":
+		keep = func(*listener.Listener) bool { return gateway }
+	case "SIDECAR_INBOUND":
+		keep = func(l *listener.Listener) bool { return !gateway && inbound(l) }
+	case "SIDECAR_OUTBOUND":
+		keep = func(l *listener.Listener) bool { return !gateway && !inbound(l) }
+	default:
+		return nil, fmt.Errorf("unsupported patch context %q", patchContext)
+	}
+	var out []*listener.Listener
+	for _, l := range listeners {
+		if keep(l) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// isGateway returns true if the config dump is of an Istio gateway, whose node ID has the "router"
+// proxy type (e.g. "router~10.0.0.1~gw.ns~ns.svc.cluster.local"). Config dumps without a bootstrap
+// are assumed to be of a sidecar.
+func isGateway(cfg *admin.ConfigDump) (bool, error) {
+	for _, c := range cfg.GetConfigs() {
+		if !c.MessageIs(&admin.BootstrapConfigDump{}) {
+			continue
+		}
+		dump := &admin.BootstrapConfigDump{}
+		if err := c.UnmarshalTo(dump); err != nil {
+			return false, fmt.Errorf("failed unmarshalling bootstrap config dump: %v", err)
+		}
+		return strings.HasPrefix(dump.GetBootstrap().GetNode().GetId(), "router~"), nil
+	}
+	return false, nil
+}
+
+// hasFilter returns true if the listener has a listener, network or HTTP filter with the given name.
+func hasFilter(l *listener.Listener, name string) (bool, error) {
+	for _, f := range l.GetListenerFilters() {
+		if f.GetName() == name {
+			return true, nil
+		}
+	}
+	chains := append([]*listener.FilterChain{}, l.GetFilterChains()...)
+	if l.GetDefaultFilterChain() != nil {
+		chains = append(chains, l.GetDefaultFilterChain())
+	}
+	for _, fc := range chains {
+		for _, f := range fc.GetFilters() {
+			if f.GetName() == name {
+				return true, nil
+			}
+		}
+	}
+	filters, err := httpFilters(l)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range filters {
+		if f.GetName() == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListenerFilters returns the names of the listener filters on the listeners in the config dump
+// bound to the given port. See Sidecar.ListenerFilters.
+func ListenerFilters(cfg *admin.ConfigDump, port uint32) ([]string, error) {
+	listeners, err := ListenerConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	out := make([]string, 0)
+	seen := sets.New[string]()
+	for _, l := range listeners {
+		if l.GetAddress().GetSocketAddress().GetPortValue() != port {
+			continue
+		}
+		found = true
+		for _, f := range l.GetListenerFilters() {
+			if !seen.InsertContains(f.GetName()) {
+				out = append(out, f.GetName())
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no listener found on port %d", port)
+	}
+	return out, nil
+}
+
+// ListenerSummary returns the number of listeners of each type in the config dump. See
+// Sidecar.ListenerSummary.
+func ListenerSummary(cfg *admin.ConfigDump) (inbound, outbound, virtual int, err error) {
+	listeners, err := ListenerConfigurations(cfg)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	inbound, outbound, virtual = summarizeListeners(listeners)
+	return inbound, outbound, virtual, nil
+}
+
+// FilterPresentInContext returns true if the filter is on any listener in the config dump that an
+// EnvoyFilter patch with the given context applies to. See Sidecar.FilterPresentInContext.
+func FilterPresentInContext(cfg *admin.ConfigDump, patchContext string, filterName string) (bool, error) {
+	listeners, err := ListenerConfigurations(cfg)
+	if err != nil {
+		return false, err
+	}
+	gateway, err := isGateway(cfg)
+	if err != nil {
+		return false, err
+	}
+	listeners, err = listenersForPatchContext(listeners, patchContext, gateway)
+	if err != nil {
+		return false, err
+	}
+	for _, l := range listeners {
+		found, err := hasFilter(l, filterName)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// CompressionConfig returns the first compressor HTTP filter config on the listeners in the config
+// dump bound to the given port. See Sidecar.CompressionConfig.
+func CompressionConfig(cfg *admin.ConfigDump, port uint32) (proto.Message, bool, error) {
+	listeners, err := ListenerConfigurations(cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, l := range listeners {
+		if l.GetAddress().GetSocketAddress().GetPortValue() != port {
+			continue
+		}
+		filters, err := httpFilters(l)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, f := range filters {
+			a := f.GetTypedConfig()
+			if a == nil || !a.MessageIs(&compressor.Compressor{}) {
+				continue
+			}
+			c := &compressor.Compressor{}
+			if err := a.UnmarshalTo(c); err != nil {
+				return nil, false, fmt.Errorf("failed unmarshalling compressor filter in listener %s: %v", l.GetName(), err)
+			}
+			return c, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// configDumpNoiseFields are the config dump fields that change on every push, regardless of
+// whether the resource changed.
+var configDumpNoiseFields = sets.New("last_updated", "version_info")
+
+// configDumpResourceNames maps the resource lists of the config dump, whose order varies between
+// pushes, to the path of the name of each resource in the list.
+var configDumpResourceNames = map[string][]string{
+	"static_clusters":              {"cluster", "name"},
+	"dynamic_active_clusters":      {"cluster", "name"},
+	"dynamic_warming_clusters":     {"cluster", "name"},
+	"static_listeners":             {"listener", "name"},
+	"dynamic_listeners":            {"name"},
+	"static_route_configs":         {"route_config", "name"},
+	"dynamic_route_configs":        {"route_config", "name"},
+	"static_scoped_route_configs":  {"name"},
+	"dynamic_scoped_route_configs": {"name"},
+	"static_endpoint_configs":      {"endpoint_config", "cluster_name"},
+	"dynamic_endpoint_configs":     {"endpoint_config", "cluster_name"},
+	"static_secrets":               {"name"},
+	"dynamic_active_secrets":       {"name"},
+	"dynamic_warming_secrets":      {"name"},
+}
+
+// ConfigDiff returns a unified diff of the two config dumps, after normalizing them. Returns an
+// empty string if there is no difference.
+func ConfigDiff(before, after *admin.ConfigDump) (string, error) {
+	a, err := NormalizeConfigDump(before)
+	if err != nil {
+		return "", fmt.Errorf("failed normalizing config dump before: %v", err)
+	}
+	b, err := NormalizeConfigDump(after)
+	if err != nil {
+		return "", fmt.Errorf("failed normalizing config dump after: %v", err)
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: "before",
+		ToFile:   "after",
+		Context:  3,
+	})
+}
+
+// NormalizeConfigDump returns the config dump as indented JSON with sorted keys, without the
+// fields in configDumpNoiseFields, and with the clusters, listeners, routes, endpoints and secrets
+// sorted by name.
+func NormalizeConfigDump(cfg *admin.ConfigDump) (string, error) {
+	js, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	var v any
+	if err := json.Unmarshal(js, &v); err != nil {
+		return "", err
+	}
+	stripFields(v, configDumpNoiseFields)
+	sortResources(v)
+	// Maps are marshalled with sorted keys.
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+func stripFields(v any, fields sets.String) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if fields.Contains(k) {
+				delete(t, k)
+				continue
+			}
+			stripFields(child, fields)
+		}
+	case []any:
+		for _, child := range t {
+			stripFields(child, fields)
+		}
+	}
+}
+
+// sortResources sorts the resource lists in configDumpResourceNames by the name of each resource.
+func sortResources(v any) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if path, ok := configDumpResourceNames[k]; ok {
+				if list, ok := child.([]any); ok {
+					sort.SliceStable(list, func(i, j int) bool {
+						return resourceName(list[i], path) < resourceName(list[j], path)
+					})
+				}
+			}
+			sortResources(child)
+		}
+	case []any:
+		for _, child := range t {
+			sortResources(child)
+		}
+	}
+}
+
+// resourceName returns the string at the path of the resource, or "" if there is none.
+func resourceName(v any, path []string) string {
+	for _, k := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	name, _ := v.(string)
+	return name
+}
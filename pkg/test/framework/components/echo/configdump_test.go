@@ -0,0 +1,412 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestFilterInPatchContext(t *testing.T) {
+	hcmConfig, err := anypb.New(&hcm.HttpConnectionManager{
+		HttpFilters: []*hcm.HttpFilter{{Name: "envoy.filters.http.lua"}, {Name: "envoy.filters.http.router"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listeners := []*listener.Listener{
+		{
+			Name:             virtualInboundListenerName,
+			TrafficDirection: core.TrafficDirection_INBOUND,
+			ListenerFilters:  []*listener.ListenerFilter{{Name: "envoy.filters.listener.tls_inspector"}},
+		},
+		{
+			Name:             "0.0.0.0_80",
+			TrafficDirection: core.TrafficDirection_OUTBOUND,
+			FilterChains: []*listener.FilterChain{{
+				Filters: []*listener.Filter{{
+					Name:       "envoy.filters.network.http_connection_manager",
+					ConfigType: &listener.Filter_TypedConfig{TypedConfig: hcmConfig},
+				}},
+			}},
+		},
+	}
+
+	cases := []struct {
+		context string
+		filter  string
+		gateway bool
+		want    bool
+	}{
+		{context: "SIDECAR_OUTBOUND", filter: "envoy.filters.http.lua", want: true},
+		{context: "SIDECAR_OUTBOUND", filter: "envoy.filters.network.http_connection_manager", want: true},
+		{context: "SIDECAR_OUTBOUND", filter: "envoy.filters.listener.tls_inspector", want: false},
+		{context: "SIDECAR_INBOUND", filter: "envoy.filters.listener.tls_inspector", want: true},
+		{context: "SIDECAR_INBOUND", filter: "envoy.filters.http.lua", want: false},
+		{context: "ANY", filter: "envoy.filters.http.lua", want: true},
+		{context: "ANY", filter: "envoy.filters.http.fault", want: false},
+		// GATEWAY patches don't apply to sidecars, and SIDECAR patches don't apply to gateways.
+		{context: "GATEWAY", filter: "envoy.filters.http.lua", want: false},
+		{context: "GATEWAY", filter: "envoy.filters.http.lua", gateway: true, want: true},
+		{context: "SIDECAR_OUTBOUND", filter: "envoy.filters.http.lua", gateway: true, want: false},
+		{context: "ANY", filter: "envoy.filters.http.lua", gateway: true, want: true},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%s/%s/gateway=%v", tc.context, tc.filter, tc.gateway), func(t *testing.T) {
+			ls, err := listenersForPatchContext(listeners, tc.context, tc.gateway)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := false
+			for _, l := range ls {
+				found, err := hasFilter(l, tc.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = got || found
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := listenersForPatchContext(listeners, "SIDECAR", false); err == nil {
+		t.Fatal("expected error for unsupported patch context")
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	dump := func(clusters ...string) *admin.ConfigDump {
+		cd := &admin.ClustersConfigDump{VersionInfo: "v" + strconv.Itoa(len(clusters))}
+		for i, c := range clusters {
+			a, err := anypb.New(&envoycluster.Cluster{Name: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cd.DynamicActiveClusters = append(cd.DynamicActiveClusters, &admin.ClustersConfigDump_DynamicCluster{
+				VersionInfo: strconv.Itoa(i),
+				Cluster:     a,
+				LastUpdated: timestamppb.New(time.Unix(int64(i+len(clusters)), 0)),
+			})
+		}
+		a, err := anypb.New(cd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &admin.ConfigDump{Configs: []*anypb.Any{a}}
+	}
+
+	same, err := ConfigDiff(dump("a"), dump("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != "" {
+		t.Fatalf("expected no diff, got:\n%s", same)
+	}
+
+	diff, err := ConfigDiff(dump("a"), dump("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, `+            "name": "b"`) {
+		t.Fatalf("expected added cluster in diff, got:\n%s", diff)
+	}
+	if strings.Contains(diff, "version_info") || strings.Contains(diff, "last_updated") {
+		t.Fatalf("expected noise fields to be stripped, got:\n%s", diff)
+	}
+}
+
+func TestNormalizeConfigDumpOrder(t *testing.T) {
+	dump := func(clusters, listeners, routes []string) *admin.ConfigDump {
+		cd := &admin.ClustersConfigDump{}
+		for _, c := range clusters {
+			a, err := anypb.New(&envoycluster.Cluster{Name: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cd.DynamicActiveClusters = append(cd.DynamicActiveClusters, &admin.ClustersConfigDump_DynamicCluster{Cluster: a})
+		}
+		ld := &admin.ListenersConfigDump{}
+		for _, l := range listeners {
+			a, err := anypb.New(&listener.Listener{Name: l})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ld.DynamicListeners = append(ld.DynamicListeners, &admin.ListenersConfigDump_DynamicListener{
+				Name:        l,
+				ActiveState: &admin.ListenersConfigDump_DynamicListenerState{Listener: a},
+			})
+		}
+		rd := &admin.RoutesConfigDump{}
+		for _, r := range routes {
+			a, err := anypb.New(&route.RouteConfiguration{Name: r})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rd.DynamicRouteConfigs = append(rd.DynamicRouteConfigs, &admin.RoutesConfigDump_DynamicRouteConfig{RouteConfig: a})
+		}
+		out := &admin.ConfigDump{}
+		for _, m := range []proto.Message{cd, ld, rd} {
+			a, err := anypb.New(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out.Configs = append(out.Configs, a)
+		}
+		return out
+	}
+
+	a, err := NormalizeConfigDump(dump([]string{"a", "b", "c"}, []string{"0.0.0.0_80", "virtualInbound"}, []string{"80", "9080"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NormalizeConfigDump(dump([]string{"c", "a", "b"}, []string{"virtualInbound", "0.0.0.0_80"}, []string{"9080", "80"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Fatalf("dumps differing only in order normalized differently:\n%s\n%s", a, b)
+	}
+	if strings.Index(a, `"name": "a"`) > strings.Index(a, `"name": "c"`) {
+		t.Fatalf("expected clusters sorted by name, got:\n%s", a)
+	}
+}
+
+func TestFindCluster(t *testing.T) {
+	dump := func(clusters ...string) *admin.ConfigDump {
+		cd := &admin.ClustersConfigDump{}
+		for _, c := range clusters {
+			a, err := anypb.New(&envoycluster.Cluster{Name: c})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cd.DynamicActiveClusters = append(cd.DynamicActiveClusters, &admin.ClustersConfigDump_DynamicCluster{Cluster: a})
+		}
+		a, err := anypb.New(cd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &admin.ConfigDump{Configs: []*anypb.Any{a}}
+	}
+	const foo = "foo.ns.svc.cluster.local"
+
+	cases := []struct {
+		name     string
+		clusters []string
+		find     string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "full name",
+			clusters: []string{"outbound|80|v1|" + foo, "outbound|80||" + foo},
+			find:     "outbound|80|v1|" + foo,
+			want:     "outbound|80|v1|" + foo,
+		},
+		{
+			name:     "fqdn skips subsets",
+			clusters: []string{"outbound|80|v1|" + foo, "outbound|80||" + foo},
+			find:     foo,
+			want:     "outbound|80||" + foo,
+		},
+		{
+			name:     "fqdn with only subsets",
+			clusters: []string{"outbound|80|v1|" + foo},
+			find:     foo,
+			wantErr:  "not found",
+		},
+		{
+			name:     "fqdn with several ports",
+			clusters: []string{"outbound|80||" + foo, "outbound|443||" + foo},
+			find:     foo,
+			wantErr:  "pass the full cluster name",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := FindCluster(dump(tc.clusters...), tc.find)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.GetName() != tc.want {
+				t.Fatalf("got cluster %s, want %s", c.GetName(), tc.want)
+			}
+		})
+	}
+}
+
+func TestIsMutualTLS(t *testing.T) {
+	socket := func(t *testing.T, ctx *tls.UpstreamTlsContext) *core.TransportSocket {
+		a, err := anypb.New(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &core.TransportSocket{
+			Name:       "envoy.transport_sockets.tls",
+			ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: a},
+		}
+	}
+	sds := &tls.UpstreamTlsContext{CommonTlsContext: &tls.CommonTlsContext{
+		TlsCertificateSdsSecretConfigs: []*tls.SdsSecretConfig{{Name: "default"}},
+	}}
+	inline := &tls.UpstreamTlsContext{CommonTlsContext: &tls.CommonTlsContext{
+		TlsCertificates: []*tls.TlsCertificate{{}},
+	}}
+	originate := &tls.UpstreamTlsContext{Sni: "example.com"}
+
+	cases := []struct {
+		name    string
+		cluster func(t *testing.T) *envoycluster.Cluster
+		want    bool
+	}{
+		{
+			name:    "plaintext",
+			cluster: func(*testing.T) *envoycluster.Cluster { return &envoycluster.Cluster{} },
+		},
+		{
+			name: "tls origination",
+			cluster: func(t *testing.T) *envoycluster.Cluster {
+				return &envoycluster.Cluster{TransportSocket: socket(t, originate)}
+			},
+		},
+		{
+			name: "sds client cert",
+			cluster: func(t *testing.T) *envoycluster.Cluster {
+				return &envoycluster.Cluster{TransportSocket: socket(t, sds)}
+			},
+			want: true,
+		},
+		{
+			name: "inline client cert",
+			cluster: func(t *testing.T) *envoycluster.Cluster {
+				return &envoycluster.Cluster{TransportSocket: socket(t, inline)}
+			},
+			want: true,
+		},
+		{
+			name: "auto mtls",
+			cluster: func(t *testing.T) *envoycluster.Cluster {
+				return &envoycluster.Cluster{TransportSocketMatches: []*envoycluster.Cluster_TransportSocketMatch{
+					{Name: "tlsMode-istio", TransportSocket: socket(t, sds)},
+					{Name: "tlsMode-disabled", TransportSocket: &core.TransportSocket{Name: "envoy.transport_sockets.raw_buffer"}},
+				}}
+			},
+			want: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := isMutualTLS(tc.cluster(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerHashConfig(t *testing.T) {
+	const name = "outbound|80||foo.ns.svc.cluster.local"
+	ring := &envoycluster.Cluster_RingHashLbConfig{MinimumRingSize: wrapperspb.UInt64(1024)}
+	c, err := anypb.New(&envoycluster.Cluster{
+		Name:     name,
+		LbPolicy: envoycluster.Cluster_RING_HASH,
+		LbConfig: &envoycluster.Cluster_RingHashLbConfig_{RingHashLbConfig: ring},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters, err := anypb.New(&admin.ClustersConfigDump{
+		DynamicActiveClusters: []*admin.ClustersConfigDump_DynamicCluster{{Cluster: c}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byHeader := &route.RouteAction_HashPolicy{PolicySpecifier: &route.RouteAction_HashPolicy_Header_{
+		Header: &route.RouteAction_HashPolicy_Header{HeaderName: "x-user"},
+	}}
+	byCookie := &route.RouteAction_HashPolicy{PolicySpecifier: &route.RouteAction_HashPolicy_Cookie_{
+		Cookie: &route.RouteAction_HashPolicy_Cookie{Name: "session"},
+	}}
+	routeTo := func(cluster string, policies ...*route.RouteAction_HashPolicy) *route.Route {
+		return &route.Route{
+			Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+			Action: &route.Route_Route{Route: &route.RouteAction{
+				ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster},
+				HashPolicy:       policies,
+			}},
+		}
+	}
+	routes := &admin.RoutesConfigDump{}
+	for _, rc := range []*route.RouteConfiguration{
+		{Name: "8080", VirtualHosts: []*route.VirtualHost{{Name: "foo", Routes: []*route.Route{routeTo(name, byHeader)}}}},
+		{Name: "80", VirtualHosts: []*route.VirtualHost{{Name: "foo", Routes: []*route.Route{
+			routeTo("outbound|80||bar.ns.svc.cluster.local", byCookie),
+			routeTo(name, byHeader),
+		}}}},
+	} {
+		a, err := anypb.New(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes.DynamicRouteConfigs = append(routes.DynamicRouteConfigs, &admin.RoutesConfigDump_DynamicRouteConfig{RouteConfig: a})
+	}
+	r, err := anypb.New(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &admin.ConfigDump{Configs: []*anypb.Any{clusters, r}}
+
+	lb, err := LoadBalancerHashConfig(cfg, "foo.ns.svc.cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(lb.RingHash, ring) || lb.Maglev != nil {
+		t.Fatalf("got ring hash %v and maglev %v, want ring hash %v", lb.RingHash, lb.Maglev, ring)
+	}
+	// The policy of the route to bar is not included, and the duplicate policy is dropped.
+	if len(lb.HashPolicies) != 1 || !proto.Equal(lb.HashPolicies[0], byHeader) {
+		t.Fatalf("got hash policies %v, want [%v]", lb.HashPolicies, byHeader)
+	}
+
+	if _, err := LoadBalancerHashConfig(cfg, "baz.ns.svc.cluster.local"); err == nil {
+		t.Fatal("expected missing cluster to fail")
+	}
+}
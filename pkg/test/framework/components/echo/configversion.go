@@ -0,0 +1,72 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"fmt"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+)
+
+// ConfigVersions returns the xDS version_info of each dynamic resource type in the config dump.
+// Listeners and clusters are versioned as a whole, under the keys "LDS" and "CDS". Envoy tracks
+// route and endpoint versions per resource, so these are keyed by "RDS/<route config name>" and
+// "EDS/<cluster name>". Endpoints are only present if the config dump includes EDS.
+func ConfigVersions(cfg *admin.ConfigDump) (map[string]string, error) {
+	out := map[string]string{}
+	for _, c := range cfg.GetConfigs() {
+		switch {
+		case c.MessageIs(&admin.ListenersConfigDump{}):
+			dump := &admin.ListenersConfigDump{}
+			if err := c.UnmarshalTo(dump); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling listeners config dump: %v", err)
+			}
+			out["LDS"] = dump.GetVersionInfo()
+		case c.MessageIs(&admin.ClustersConfigDump{}):
+			dump := &admin.ClustersConfigDump{}
+			if err := c.UnmarshalTo(dump); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling clusters config dump: %v", err)
+			}
+			out["CDS"] = dump.GetVersionInfo()
+		case c.MessageIs(&admin.RoutesConfigDump{}):
+			dump := &admin.RoutesConfigDump{}
+			if err := c.UnmarshalTo(dump); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling routes config dump: %v", err)
+			}
+			for _, r := range dump.GetDynamicRouteConfigs() {
+				rc := &route.RouteConfiguration{}
+				if err := r.GetRouteConfig().UnmarshalTo(rc); err != nil {
+					return nil, fmt.Errorf("failed unmarshalling route configuration: %v", err)
+				}
+				out["RDS/"+rc.GetName()] = r.GetVersionInfo()
+			}
+		case c.MessageIs(&admin.EndpointsConfigDump{}):
+			dump := &admin.EndpointsConfigDump{}
+			if err := c.UnmarshalTo(dump); err != nil {
+				return nil, fmt.Errorf("failed unmarshalling endpoints config dump: %v", err)
+			}
+			for _, e := range dump.GetDynamicEndpointConfigs() {
+				cla := &endpoint.ClusterLoadAssignment{}
+				if err := e.GetEndpointConfig().UnmarshalTo(cla); err != nil {
+					return nil, fmt.Errorf("failed unmarshalling cluster load assignment: %v", err)
+				}
+				out["EDS/"+cla.GetClusterName()] = e.GetVersionInfo()
+			}
+		}
+	}
+	return out, nil
+}
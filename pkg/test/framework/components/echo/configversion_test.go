@@ -0,0 +1,62 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"testing"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestConfigVersions(t *testing.T) {
+	mustAny := func(m proto.Message) *anypb.Any {
+		a, err := anypb.New(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	cfg := &admin.ConfigDump{Configs: []*anypb.Any{
+		mustAny(&admin.BootstrapConfigDump{}),
+		mustAny(&admin.ListenersConfigDump{VersionInfo: "l1"}),
+		mustAny(&admin.ClustersConfigDump{VersionInfo: "c1"}),
+		mustAny(&admin.RoutesConfigDump{DynamicRouteConfigs: []*admin.RoutesConfigDump_DynamicRouteConfig{
+			{VersionInfo: "r1", RouteConfig: mustAny(&route.RouteConfiguration{Name: "80"})},
+			{VersionInfo: "r2", RouteConfig: mustAny(&route.RouteConfiguration{Name: "8080"})},
+		}}),
+		mustAny(&admin.EndpointsConfigDump{DynamicEndpointConfigs: []*admin.EndpointsConfigDump_DynamicEndpointConfig{
+			{VersionInfo: "e1", EndpointConfig: mustAny(&endpoint.ClusterLoadAssignment{ClusterName: "outbound|80||a"})},
+		}}),
+	}}
+	got, err := ConfigVersions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"LDS":                "l1",
+		"CDS":                "c1",
+		"RDS/80":             "r1",
+		"RDS/8080":           "r2",
+		"EDS/outbound|80||a": "e1",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected versions (-want +got):\n%s", diff)
+	}
+}
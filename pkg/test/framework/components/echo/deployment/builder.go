@@ -71,6 +71,11 @@ type Builder interface {
 	// are assigned and all Instances are ready to communicate with each other.
 	Build() (echo.Instances, error)
 	BuildOrFail(t test.Failer) echo.Instances
+
+	// Validate the configurations added to the Builder, without deploying anything. This returns
+	// the errors that Build would fail with before deploying, as well as conflicting configurations,
+	// such as duplicate ports or services, and incomplete TLS settings.
+	Validate() error
 }
 
 var _ Builder = builder{}
@@ -405,6 +410,51 @@ func assignRefs(refs []*echo.Instance, instances echo.Instances) error {
 	return nil
 }
 
+func (b builder) Validate() error {
+	var configs []echo.Config
+	for _, cfgs := range b.configs {
+		configs = append(configs, cfgs...)
+	}
+	return multierror.Append(b.errs, validateConfigs(configs)).ErrorOrNil()
+}
+
+// validateConfigs checks the per-cluster configs for conflicts that would only be detected when
+// deploying.
+func validateConfigs(configs []echo.Config) error {
+	var errs error
+	services := sets.New[string]()
+	for _, cfg := range configs {
+		if cfg.Namespace == nil {
+			errs = multierror.Append(errs, fmt.Errorf("app %s: namespace is not set", cfg.Service))
+			continue
+		}
+		clusterName := ""
+		if cfg.Cluster != nil {
+			clusterName = cfg.Cluster.Name()
+		}
+		name := cfg.Namespace.Name() + "/" + cfg.Service
+		if services.InsertContains(clusterName + "/" + name) {
+			errs = multierror.Append(errs, fmt.Errorf("app %s: deployed more than once to cluster %s", name, clusterName))
+		}
+
+		portNames := sets.New[string]()
+		servicePorts := sets.New[int]()
+		for _, p := range cfg.Ports {
+			if portNames.InsertContains(p.Name) {
+				errs = multierror.Append(errs, fmt.Errorf("app %s: duplicate port name %q", name, p.Name))
+			}
+			if p.ServicePort > 0 && servicePorts.InsertContains(p.ServicePort) {
+				errs = multierror.Append(errs, fmt.Errorf("app %s: duplicate service port %d", name, p.ServicePort))
+			}
+		}
+
+		if tls := cfg.TLSSettings; tls != nil && !tls.ProxyProvision && (tls.ClientCert == "") != (tls.Key == "") {
+			errs = multierror.Append(errs, fmt.Errorf("app %s: TLS settings must set both the certificate and key", name))
+		}
+	}
+	return errs
+}
+
 func (b builder) BuildOrFail(t test.Failer) echo.Instances {
 	t.Helper()
 	out, err := b.Build()
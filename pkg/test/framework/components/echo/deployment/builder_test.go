@@ -0,0 +1,92 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deployment
+
+import (
+	"strings"
+	"testing"
+
+	"istio.io/istio/pkg/test/echo/common"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/components/namespace"
+)
+
+func TestValidateConfigs(t *testing.T) {
+	cls1 := &cluster.FakeCluster{Topology: cluster.Topology{ClusterName: "cls1", ClusterKind: cluster.Fake}}
+	cls2 := &cluster.FakeCluster{Topology: cluster.Topology{ClusterName: "cls2", ClusterKind: cluster.Fake}}
+	ns := namespace.Static("echo")
+	a := echo.Config{Service: "a", Namespace: ns, Cluster: cls1, Ports: echo.Ports{
+		{Name: "http", ServicePort: 80},
+		{Name: "grpc", ServicePort: 7070},
+	}}
+	withCluster := func(cfg echo.Config, c cluster.Cluster) echo.Config {
+		cfg.Cluster = c
+		return cfg
+	}
+
+	cases := []struct {
+		name    string
+		configs []echo.Config
+		wantErr []string
+	}{
+		{
+			name:    "valid",
+			configs: []echo.Config{a, withCluster(a, cls2)},
+		},
+		{
+			name: "duplicate ports",
+			configs: []echo.Config{{Service: "b", Namespace: ns, Cluster: cls1, Ports: echo.Ports{
+				{Name: "http", ServicePort: 80},
+				{Name: "http", ServicePort: 80},
+			}}},
+			wantErr: []string{`duplicate port name "http"`, "duplicate service port 80"},
+		},
+		{
+			name:    "duplicate service",
+			configs: []echo.Config{a, a},
+			wantErr: []string{"app echo/a: deployed more than once to cluster cls1"},
+		},
+		{
+			name:    "missing namespace",
+			configs: []echo.Config{{Service: "c", Cluster: cls1}},
+			wantErr: []string{"app c: namespace is not set"},
+		},
+		{
+			name:    "incomplete TLS",
+			configs: []echo.Config{{Service: "d", Namespace: ns, Cluster: cls1, TLSSettings: &common.TLSSettings{ClientCert: "cert"}}},
+			wantErr: []string{"TLS settings must set both the certificate and key"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateConfigs(tc.configs)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"istio.io/istio/pkg/test/framework/components/echo"
+)
+
+// instance is an echo.Instance with the given workloads. Only the methods used to find the
+// sidecars of the instance are implemented.
+type instance struct {
+	echo.Instance
+	namespace string
+	workloads echo.Workloads
+}
+
+func (i instance) NamespaceName() string {
+	return i.namespace
+}
+
+func (i instance) Workloads() (echo.Workloads, error) {
+	return i.workloads, nil
+}
+
+// workload is an echo.Workload with the given sidecar, which may be nil for an uninjected workload.
+type workload struct {
+	echo.Workload
+	pod     string
+	sidecar echo.Sidecar
+}
+
+func (w workload) PodName() string {
+	return w.pod
+}
+
+func (w workload) Sidecar() echo.Sidecar {
+	return w.sidecar
+}
+
+// newInstances returns instances in the "echo" namespace with a workload for each named sidecar.
+// A nil sidecar is an uninjected workload.
+func newInstances(sidecars map[string]*Sidecar) echo.Instances {
+	var ws echo.Workloads
+	for pod, s := range sidecars {
+		w := workload{pod: pod}
+		if s != nil {
+			w.sidecar = s
+		}
+		ws = append(ws, w)
+	}
+	return echo.Instances{instance{namespace: "echo", workloads: ws}}
+}
+
+func TestForEachSidecar(t *testing.T) {
+	instances := newInstances(map[string]*Sidecar{
+		"a-v1":     {Name: "a-v1", Namespace: "echo"},
+		"b-v1":     {Name: "b-v1", Namespace: "echo"},
+		"external": nil,
+	})
+
+	var (
+		mu      sync.Mutex
+		visited []string
+	)
+	err := instances.ForEachSidecar(func(s echo.Sidecar) error {
+		mu.Lock()
+		visited = append(visited, s.PodName())
+		mu.Unlock()
+		if s.PodName() == "b-v1" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	sort.Strings(visited)
+	if strings.Join(visited, ",") != "a-v1,b-v1" {
+		t.Fatalf("visited %v, want the injected workloads only", visited)
+	}
+	if err == nil || !strings.Contains(err.Error(), "proxy echo/b-v1: boom") || strings.Contains(err.Error(), "a-v1") {
+		t.Fatalf("got error %v, want an error for b-v1 only", err)
+	}
+}
+
+func TestInstancesWaitForConfig(t *testing.T) {
+	accept := func(cfg *admin.ConfigDump) (bool, error) {
+		return len(cfg.Configs) > 0, nil
+	}
+	c, err := anypb.New(&admin.ClustersConfigDump{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := &admin.ConfigDump{Configs: []*anypb.Any{c}}
+
+	instances := newInstances(map[string]*Sidecar{
+		"a-v1": {ConfigDump: ready},
+		"a-v2": {ConfigDump: ready},
+	})
+	if err := instances.WaitForConfig(accept); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	instances = newInstances(map[string]*Sidecar{
+		"a-v1": {ConfigDump: ready},
+		"a-v2": {ConfigDump: &admin.ConfigDump{}},
+	})
+	err = instances.WaitForConfig(accept)
+	if err == nil || !strings.Contains(err.Error(), "proxy echo/a-v2: did not accept config") || strings.Contains(err.Error(), "a-v1") {
+		t.Fatalf("got error %v, want an error for a-v2 only", err)
+	}
+}
@@ -0,0 +1,726 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides an in-memory echo.Sidecar, for unit testing code that consumes sidecars
+// without a cluster.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	upstreamhttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+// ErrNotSupported is returned by the Sidecar queries that the fake does not implement.
+var ErrNotSupported = errors.New("not supported by fake sidecar")
+
+var _ echo.Sidecar = &Sidecar{}
+
+// Sidecar is an echo.Sidecar that serves canned admin responses. Queries for which no response
+// has been preloaded return an error. Queries of the Envoy config, such as IsMutualTLS or
+// MatchRoute, are answered from ConfigDump with the same functions as the kube sidecar. The Wait
+// methods don't retry: they check the preloaded state once, so a test fails immediately rather
+// than timing out.
+type Sidecar struct {
+	Name         string
+	Namespace    string
+	ClusterValue cluster.Cluster
+
+	ServerInfo      *admin.ServerInfo
+	ConfigDump      *admin.ConfigDump
+	ClusterStatuses *admin.Clusters
+	ListenerStatus  *admin.Listeners
+	Certificates    *admin.Certificates
+	MemoryInfo      *admin.Memory
+	RuntimeInfo     *echo.Runtime
+	StatValues      map[string]uint64
+	LogLevels       map[string]string
+	Log             string
+	EventList       []corev1.Event
+
+	// RawResponses are returned by Raw, keyed by admin path. ClustersText, ListenersText,
+	// PrometheusStats and HotRestartVersion are served from the "clusters", "listeners",
+	// "stats/prometheus" and "hot_restart_version" paths.
+	RawResponses map[string]string
+}
+
+func (s *Sidecar) PodName() string {
+	return s.Name
+}
+
+func (s *Sidecar) PodNamespace() string {
+	return s.Namespace
+}
+
+func (s *Sidecar) Cluster() cluster.Cluster {
+	return s.ClusterValue
+}
+
+func (s *Sidecar) Info() (*admin.ServerInfo, error) {
+	if s.ServerInfo == nil {
+		return nil, missing("server info")
+	}
+	return s.ServerInfo, nil
+}
+
+func (s *Sidecar) InfoContext(context.Context) (*admin.ServerInfo, error) {
+	return s.Info()
+}
+
+func (s *Sidecar) InfoOrFail(t test.Failer) *admin.ServerInfo {
+	t.Helper()
+	info, err := s.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func (s *Sidecar) Ready() (bool, error) {
+	info, err := s.Info()
+	if err != nil {
+		return false, err
+	}
+	return info.GetState() == admin.ServerInfo_LIVE, nil
+}
+
+func (s *Sidecar) WaitUntilReady(...retry.Option) error {
+	return s.checkState(admin.ServerInfo_LIVE)
+}
+
+// Drain moves the preloaded server info to the DRAINING state.
+func (s *Sidecar) Drain(echo.DrainOptions) error {
+	if s.ServerInfo == nil {
+		return missing("server info")
+	}
+	s.ServerInfo.State = admin.ServerInfo_DRAINING
+	return nil
+}
+
+func (s *Sidecar) WaitForDraining(...retry.Option) error {
+	return s.checkState(admin.ServerInfo_DRAINING)
+}
+
+func (s *Sidecar) Quit() error {
+	return ErrNotSupported
+}
+
+func (s *Sidecar) checkState(want admin.ServerInfo_State) error {
+	info, err := s.Info()
+	if err != nil {
+		return err
+	}
+	if info.GetState() != want {
+		return fmt.Errorf("envoy not in %s state: %s", want, info.GetState())
+	}
+	return nil
+}
+
+func (s *Sidecar) Memory() (*admin.Memory, error) {
+	if s.MemoryInfo == nil {
+		return nil, missing("memory")
+	}
+	return s.MemoryInfo, nil
+}
+
+func (s *Sidecar) MemoryOrFail(t test.Failer) *admin.Memory {
+	t.Helper()
+	m, err := s.Memory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func (s *Sidecar) Runtime() (*echo.Runtime, error) {
+	if s.RuntimeInfo == nil {
+		return nil, missing("runtime")
+	}
+	return s.RuntimeInfo, nil
+}
+
+func (s *Sidecar) RuntimeOrFail(t test.Failer) *echo.Runtime {
+	t.Helper()
+	r, err := s.Runtime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// HotRestartVersion is served from the "hot_restart_version" raw response.
+func (s *Sidecar) HotRestartVersion() (string, error) {
+	out, err := s.Raw("hot_restart_version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (s *Sidecar) HotRestartVersionOrFail(t test.Failer) string {
+	t.Helper()
+	v, err := s.HotRestartVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func (s *Sidecar) Config() (*admin.ConfigDump, error) {
+	if s.ConfigDump == nil {
+		return nil, missing("config dump")
+	}
+	return s.ConfigDump, nil
+}
+
+func (s *Sidecar) ConfigContext(context.Context) (*admin.ConfigDump, error) {
+	return s.Config()
+}
+
+func (s *Sidecar) ConfigOrFail(t test.Failer) *admin.ConfigDump {
+	t.Helper()
+	cfg, err := s.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// ConfigForType returns the full preloaded config dump; the fake doesn't filter by resource type.
+func (s *Sidecar) ConfigForType(string) (*admin.ConfigDump, error) {
+	return s.Config()
+}
+
+func (s *Sidecar) Bootstrap() (*admin.BootstrapConfigDump, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.BootstrapConfigDump(cfg)
+}
+
+func (s *Sidecar) BootstrapOrFail(t test.Failer) *admin.BootstrapConfigDump {
+	t.Helper()
+	b, err := s.Bootstrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (s *Sidecar) DumpDebug(string) error {
+	return ErrNotSupported
+}
+
+func (s *Sidecar) ConfigDiff(before, after *admin.ConfigDump) (string, error) {
+	return echo.ConfigDiff(before, after)
+}
+
+// WaitForConfig applies the acceptor to the preloaded config dump once.
+func (s *Sidecar) WaitForConfig(accept func(*admin.ConfigDump) (bool, error), _ ...retry.Option) error {
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+	ok, err := accept(cfg)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("envoy config rejected")
+	}
+	return nil
+}
+
+func (s *Sidecar) WaitForConfigOrFail(t test.Failer, accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) {
+	t.Helper()
+	if err := s.WaitForConfig(accept, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// WaitForConfigWithEndpoints applies the acceptor to the preloaded config dump once, which
+// includes endpoints if they were preloaded.
+func (s *Sidecar) WaitForConfigWithEndpoints(accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) error {
+	return s.WaitForConfig(accept, options...)
+}
+
+func (s *Sidecar) WaitForConfigAll(accepts []func(*admin.ConfigDump) (bool, error), options ...retry.Option) error {
+	for i, accept := range accepts {
+		if err := s.WaitForConfig(accept, options...); err != nil {
+			return fmt.Errorf("acceptor %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sidecar) WaitForConfigAllOrFail(t test.Failer, accepts []func(*admin.ConfigDump) (bool, error), options ...retry.Option) {
+	t.Helper()
+	if err := s.WaitForConfigAll(accepts, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *Sidecar) ConfigVersion() (map[string]string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.ConfigVersions(cfg)
+}
+
+// WaitForConfigVersionChange compares the version of the preloaded config dump once.
+func (s *Sidecar) WaitForConfigVersionChange(previous map[string]string, _ ...retry.Option) error {
+	current, err := s.ConfigVersion()
+	if err != nil {
+		return err
+	}
+	if maps.Equal(previous, current) {
+		return fmt.Errorf("config version unchanged: %v", current)
+	}
+	return nil
+}
+
+func (s *Sidecar) ConfigForHost(host string) (*echo.HostConfig, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.ConfigForHost(cfg, host)
+}
+
+func (s *Sidecar) Clusters() (*admin.Clusters, error) {
+	if s.ClusterStatuses == nil {
+		return nil, missing("clusters")
+	}
+	return s.ClusterStatuses, nil
+}
+
+func (s *Sidecar) ClustersContext(context.Context) (*admin.Clusters, error) {
+	return s.Clusters()
+}
+
+func (s *Sidecar) ClustersOrFail(t test.Failer) *admin.Clusters {
+	t.Helper()
+	c, err := s.Clusters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (s *Sidecar) GetEndpoints(name string) ([]echo.ClusterEndpoint, error) {
+	clusters, err := s.Clusters()
+	if err != nil {
+		return nil, err
+	}
+	return echo.EndpointsForCluster(clusters, name), nil
+}
+
+// WaitForHealthyEndpoints checks the endpoints of the preloaded clusters once.
+func (s *Sidecar) WaitForHealthyEndpoints(cluster string, min int, _ ...retry.Option) error {
+	eps, err := s.GetEndpoints(cluster)
+	if err != nil {
+		return err
+	}
+	healthy := 0
+	for _, e := range eps {
+		if e.Healthy() {
+			healthy++
+		}
+	}
+	if healthy < min {
+		return fmt.Errorf("cluster %s has %d healthy endpoints, want at least %d\n%s",
+			cluster, healthy, min, echo.FormatEndpoints(eps))
+	}
+	return nil
+}
+
+func (s *Sidecar) ClustersText() (string, error) {
+	return s.Raw("clusters")
+}
+
+func (s *Sidecar) ListenersText() (string, error) {
+	return s.Raw("listeners")
+}
+
+func (s *Sidecar) Listeners() (*admin.Listeners, error) {
+	if s.ListenerStatus == nil {
+		return nil, missing("listeners")
+	}
+	return s.ListenerStatus, nil
+}
+
+func (s *Sidecar) ListenersContext(context.Context) (*admin.Listeners, error) {
+	return s.Listeners()
+}
+
+func (s *Sidecar) ListenersOrFail(t test.Failer) *admin.Listeners {
+	t.Helper()
+	l, err := s.Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// WaitForListeners applies the acceptor to the preloaded listeners once.
+func (s *Sidecar) WaitForListeners(accept func(*admin.Listeners) (bool, error), _ ...retry.Option) error {
+	l, err := s.Listeners()
+	if err != nil {
+		return err
+	}
+	ok, err := accept(l)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("envoy listeners rejected")
+	}
+	return nil
+}
+
+func (s *Sidecar) WaitForListenersOrFail(t test.Failer, accept func(*admin.Listeners) (bool, error), options ...retry.Option) {
+	t.Helper()
+	if err := s.WaitForListeners(accept, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *Sidecar) Certs() (*admin.Certificates, error) {
+	if s.Certificates == nil {
+		return nil, missing("certificates")
+	}
+	return s.Certificates, nil
+}
+
+func (s *Sidecar) CertsContext(context.Context) (*admin.Certificates, error) {
+	return s.Certs()
+}
+
+func (s *Sidecar) CertsOrFail(t test.Failer) *admin.Certificates {
+	t.Helper()
+	c, err := s.Certs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (s *Sidecar) Secrets() (*admin.SecretsConfigDump, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.SecretsConfigDump(cfg)
+}
+
+func (s *Sidecar) SecretsOrFail(t test.Failer) *admin.SecretsConfigDump {
+	t.Helper()
+	secrets, err := s.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secrets
+}
+
+func (s *Sidecar) HTTPConnectionPool(fqdn string) (*upstreamhttp.HttpProtocolOptions, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.HTTPConnectionPool(cfg, fqdn)
+}
+
+func (s *Sidecar) HealthChecks(fqdn string) ([]*core.HealthCheck, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.HealthChecks(cfg, fqdn)
+}
+
+func (s *Sidecar) LoadBalancerPolicy(fqdn string) (envoycluster.Cluster_LbPolicy, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return envoycluster.Cluster_ROUND_ROBIN, err
+	}
+	return echo.LoadBalancerPolicy(cfg, fqdn)
+}
+
+func (s *Sidecar) LoadBalancerHash(fqdn string) (*echo.LoadBalancerHash, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.LoadBalancerHashConfig(cfg, fqdn)
+}
+
+func (s *Sidecar) UpstreamTLSSANs(fqdn string) ([]string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.UpstreamTLSSANs(cfg, fqdn)
+}
+
+func (s *Sidecar) IsMutualTLS(fqdn string) (bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return false, err
+	}
+	return echo.IsMutualTLS(cfg, fqdn)
+}
+
+func (s *Sidecar) ListenerFilters(port uint32) ([]string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.ListenerFilters(cfg, port)
+}
+
+func (s *Sidecar) ListenerSummary() (int, int, int, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return echo.ListenerSummary(cfg)
+}
+
+func (s *Sidecar) FilterPresentInContext(context string, filterName string) (bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return false, err
+	}
+	return echo.FilterPresentInContext(cfg, context, filterName)
+}
+
+func (s *Sidecar) CompressionConfig(port uint32) (proto.Message, bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, false, err
+	}
+	return echo.CompressionConfig(cfg, port)
+}
+
+func (s *Sidecar) Stats() (map[string]uint64, error) {
+	if s.StatValues == nil {
+		return nil, missing("stats")
+	}
+	return s.StatValues, nil
+}
+
+func (s *Sidecar) StatsContext(context.Context) (map[string]uint64, error) {
+	return s.Stats()
+}
+
+func (s *Sidecar) StatsOrFail(t test.Failer) map[string]uint64 {
+	t.Helper()
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func (s *Sidecar) PrometheusStats() (map[string]*dto.MetricFamily, error) {
+	out, err := s.Raw("stats/prometheus")
+	if err != nil {
+		return nil, err
+	}
+	return echo.ParsePrometheusStats(out)
+}
+
+// ResetStats zeroes the preloaded stats.
+func (s *Sidecar) ResetStats() error {
+	for k := range s.StatValues {
+		s.StatValues[k] = 0
+	}
+	return nil
+}
+
+func (s *Sidecar) WaitForStat(name string, predicate func(uint64) bool, _ ...retry.Option) error {
+	stats, err := s.Stats()
+	if err != nil {
+		return err
+	}
+	v, ok := stats[name]
+	if !ok {
+		return fmt.Errorf("stat %s not found", name)
+	}
+	if !predicate(v) {
+		return fmt.Errorf("stat %s has value %d, which does not satisfy the predicate", name, v)
+	}
+	return nil
+}
+
+func (s *Sidecar) WaitForStatAtLeast(name string, min float64, options ...retry.Option) error {
+	return s.WaitForStat(name, func(v uint64) bool { return float64(v) >= min }, options...)
+}
+
+func (s *Sidecar) Locality() (string, string, string, error) {
+	b, err := s.Bootstrap()
+	if err != nil {
+		return "", "", "", err
+	}
+	l := b.GetBootstrap().GetNode().GetLocality()
+	return l.GetRegion(), l.GetZone(), l.GetSubZone(), nil
+}
+
+func (s *Sidecar) RoutedHosts(routeConfigName string) ([]string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.RoutedHosts(cfg, routeConfigName)
+}
+
+func (s *Sidecar) RouteMirrorPolicies(routeName string) ([]*route.RouteAction_RequestMirrorPolicy, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.RouteMirrorPolicies(cfg, routeName)
+}
+
+func (s *Sidecar) MatchRoute(host string, path string, headers map[string]string) (string, bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return "", false, err
+	}
+	return echo.MatchRoute(cfg, host, path, headers)
+}
+
+func (s *Sidecar) Raw(path string) (string, error) {
+	out, ok := s.RawResponses[path]
+	if !ok {
+		return "", missing("response for " + path)
+	}
+	return out, nil
+}
+
+func (s *Sidecar) SetLogLevel(logger, level string) error {
+	if s.LogLevels == nil {
+		s.LogLevels = map[string]string{}
+	}
+	s.LogLevels[logger] = level
+	return nil
+}
+
+func (s *Sidecar) GetLogLevels() (map[string]string, error) {
+	if s.LogLevels == nil {
+		return nil, missing("log levels")
+	}
+	return s.LogLevels, nil
+}
+
+func (s *Sidecar) Logs() (string, error) {
+	return s.Log, nil
+}
+
+func (s *Sidecar) LogsOrFail(t test.Failer) string {
+	t.Helper()
+	logs, err := s.Logs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logs
+}
+
+// LogsWithOptions honors TailLines; the other options are ignored.
+func (s *Sidecar) LogsWithOptions(opts echo.LogOptions) (string, error) {
+	if opts.TailLines == nil {
+		return s.Log, nil
+	}
+	lines := logLines(s.Log)
+	if n := int(*opts.TailLines); n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// FollowLogs sends each preloaded log line, then closes the channel.
+func (s *Sidecar) FollowLogs(ctx context.Context) (<-chan string, error) {
+	lines := logLines(s.Log)
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for _, l := range lines {
+			select {
+			case ch <- l:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (s *Sidecar) Events() ([]corev1.Event, error) {
+	return s.EventList, nil
+}
+
+func (s *Sidecar) EventsOrFail(t test.Failer) []corev1.Event {
+	t.Helper()
+	events, err := s.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// WaitForLog checks the preloaded log lines once.
+func (s *Sidecar) WaitForLog(predicate func(line string) bool, _ ...retry.Option) error {
+	for _, l := range logLines(s.Log) {
+		if predicate(l) {
+			return nil
+		}
+	}
+	return errors.New("no log line matched")
+}
+
+func (s *Sidecar) WaitForLogOrFail(t test.Failer, predicate func(line string) bool, options ...retry.Option) {
+	t.Helper()
+	if err := s.WaitForLog(predicate, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func logLines(logs string) []string {
+	if logs == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(logs, "\n"), "\n")
+}
+
+func missing(what string) error {
+	return fmt.Errorf("fake sidecar has no %s", what)
+}
@@ -0,0 +1,101 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"testing"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestWaitForConfig(t *testing.T) {
+	s := &Sidecar{ConfigDump: &admin.ConfigDump{}}
+	accept := func(want bool) func(*admin.ConfigDump) (bool, error) {
+		return func(*admin.ConfigDump) (bool, error) { return want, nil }
+	}
+	if err := s.WaitForConfig(accept(true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.WaitForConfig(accept(false)); err == nil {
+		t.Fatal("expected rejected config to fail")
+	}
+	if err := (&Sidecar{}).WaitForConfig(accept(true)); err == nil {
+		t.Fatal("expected missing config dump to fail")
+	}
+}
+
+func TestGetEndpoints(t *testing.T) {
+	s := &Sidecar{ClusterStatuses: &admin.Clusters{ClusterStatuses: []*admin.ClusterStatus{{
+		Name: "outbound|80||foo.ns.svc.cluster.local",
+		HostStatuses: []*admin.HostStatus{{Address: &core.Address{Address: &core.Address_SocketAddress{
+			SocketAddress: &core.SocketAddress{Address: "10.0.0.1"},
+		}}}},
+	}}}}
+	eps, err := s.GetEndpoints("outbound|80||foo.ns.svc.cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 1 || eps[0].Address != "10.0.0.1" {
+		t.Fatalf("unexpected endpoints: %+v", eps)
+	}
+}
+
+func TestClusterQueries(t *testing.T) {
+	c, err := anypb.New(&envoycluster.Cluster{
+		Name:     "outbound|80||foo.ns.svc.cluster.local",
+		LbPolicy: envoycluster.Cluster_LEAST_REQUEST,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump, err := anypb.New(&admin.ClustersConfigDump{
+		DynamicActiveClusters: []*admin.ClustersConfigDump_DynamicCluster{{Cluster: c}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Sidecar{ConfigDump: &admin.ConfigDump{Configs: []*anypb.Any{dump}}}
+
+	lb, err := s.LoadBalancerPolicy("foo.ns.svc.cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lb != envoycluster.Cluster_LEAST_REQUEST {
+		t.Fatalf("got load balancer policy %v, want LEAST_REQUEST", lb)
+	}
+	mtls, err := s.IsMutualTLS("foo.ns.svc.cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtls {
+		t.Fatal("expected cluster without TLS not to be mutual TLS")
+	}
+	if _, err := s.IsMutualTLS("bar.ns.svc.cluster.local"); err == nil {
+		t.Fatal("expected missing cluster to fail")
+	}
+}
+
+func TestLogs(t *testing.T) {
+	s := &Sidecar{Log: "a\nb\nc\n"}
+	if err := s.WaitForLog(func(l string) bool { return l == "b" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WaitForLog(func(l string) bool { return l == "d" }); err == nil {
+		t.Fatal("expected no match")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcpproxy "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+
+	"istio.io/istio/pkg/util/sets"
+)
+
+// HostConfig is the subset of an Envoy config dump that applies to requests for a single host, as
+// returned by Sidecar.ConfigForHost.
+type HostConfig struct {
+	// Listeners that send traffic for the host: those using one of the RouteConfigs, and those
+	// proxying TCP to one of the Clusters.
+	Listeners []*listener.Listener
+	// RouteConfigs with a virtual host for the host.
+	RouteConfigs []*route.RouteConfiguration
+	// VirtualHosts for the host, in the same order as RouteConfigs.
+	VirtualHosts []*route.VirtualHost
+	// Clusters that the virtual hosts route to, and the outbound clusters of the host.
+	Clusters []*envoycluster.Cluster
+	// Endpoints of the Clusters, keyed by cluster name. Endpoints of EDS clusters are those of the
+	// cluster's EDS service name.
+	Endpoints map[string]*endpoint.ClusterLoadAssignment
+}
+
+// ConfigForHost correlates the config dump for the given host, which may include a port. Route
+// configurations are selected by an exact domain match on their virtual hosts. Clusters are those
+// routed to from the selected virtual hosts, plus the Istio outbound clusters of the host (on the
+// given port, if any), so that TCP services without routes are covered. Listeners are those that
+// use a selected route configuration, or proxy TCP to a selected cluster.
+func ConfigForHost(cfg *admin.ConfigDump, host string) (*HostConfig, error) {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+
+	out := &HostConfig{Endpoints: map[string]*endpoint.ClusterLoadAssignment{}}
+
+	rcs, err := RouteConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rcNames := sets.New[string]()
+	clusterNames := sets.New[string]()
+	for _, rc := range rcs {
+		vh := virtualHostWithDomain(rc, host)
+		if vh == nil {
+			continue
+		}
+		out.RouteConfigs = append(out.RouteConfigs, rc)
+		out.VirtualHosts = append(out.VirtualHosts, vh)
+		rcNames.Insert(rc.GetName())
+		for _, r := range vh.GetRoutes() {
+			clusterNames.InsertAll(routeClusters(r)...)
+		}
+	}
+
+	clusters, err := ClusterConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clusters {
+		if clusterNames.Contains(c.GetName()) || isOutboundClusterFor(c.GetName(), hostname, port) {
+			clusterNames.Insert(c.GetName())
+			out.Clusters = append(out.Clusters, c)
+		}
+	}
+
+	if len(out.RouteConfigs) == 0 && len(out.Clusters) == 0 {
+		return nil, fmt.Errorf("no Envoy config references host %s", host)
+	}
+
+	listeners, err := ListenerConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range listeners {
+		uses, err := listenerUses(l, rcNames, clusterNames)
+		if err != nil {
+			return nil, err
+		}
+		if uses {
+			out.Listeners = append(out.Listeners, l)
+		}
+	}
+
+	assignments, err := EndpointConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range out.Clusters {
+		if cla := clusterLoadAssignment(c, assignments); cla != nil {
+			out.Endpoints[c.GetName()] = cla
+		}
+	}
+	return out, nil
+}
+
+// virtualHostWithDomain returns the first virtual host in the route configuration that has the
+// given domain, or nil if there is none. Unlike virtualHostFor, wildcards are not matched.
+func virtualHostWithDomain(rc *route.RouteConfiguration, domain string) *route.VirtualHost {
+	for _, vh := range rc.GetVirtualHosts() {
+		for _, d := range vh.GetDomains() {
+			if strings.EqualFold(d, domain) {
+				return vh
+			}
+		}
+	}
+	return nil
+}
+
+// routeClusters returns all clusters the route forwards to, including every weighted cluster.
+func routeClusters(r *route.Route) []string {
+	if wc := r.GetRoute().GetWeightedClusters(); wc != nil {
+		var out []string
+		for _, c := range wc.GetClusters() {
+			out = append(out, c.GetName())
+		}
+		return out
+	}
+	if c := r.GetRoute().GetCluster(); c != "" {
+		return []string{c}
+	}
+	return nil
+}
+
+// isOutboundClusterFor returns true if the cluster name is an Istio outbound cluster
+// (outbound|port|subset|host) for the host, and the port if it is not empty.
+func isOutboundClusterFor(name, host, port string) bool {
+	parts := strings.Split(name, "|")
+	if len(parts) != 4 || parts[0] != "outbound" || parts[3] != host {
+		return false
+	}
+	return port == "" || parts[1] == port
+}
+
+// listenerUses returns true if any of the listener's filter chains has an HTTP connection manager
+// using one of the route configurations, or a TCP proxy to one of the clusters.
+func listenerUses(l *listener.Listener, rcNames, clusterNames sets.String) (bool, error) {
+	chains := append([]*listener.FilterChain{}, l.GetFilterChains()...)
+	if l.GetDefaultFilterChain() != nil {
+		chains = append(chains, l.GetDefaultFilterChain())
+	}
+	for _, fc := range chains {
+		for _, f := range fc.GetFilters() {
+			a := f.GetTypedConfig()
+			switch {
+			case a == nil:
+			case a.MessageIs(&hcm.HttpConnectionManager{}):
+				m := &hcm.HttpConnectionManager{}
+				if err := a.UnmarshalTo(m); err != nil {
+					return false, fmt.Errorf("failed unmarshalling HTTP connection manager in listener %s: %v", l.GetName(), err)
+				}
+				if rcNames.Contains(m.GetRds().GetRouteConfigName()) || rcNames.Contains(m.GetRouteConfig().GetName()) {
+					return true, nil
+				}
+			case a.MessageIs(&tcpproxy.TcpProxy{}):
+				m := &tcpproxy.TcpProxy{}
+				if err := a.UnmarshalTo(m); err != nil {
+					return false, fmt.Errorf("failed unmarshalling TCP proxy in listener %s: %v", l.GetName(), err)
+				}
+				if clusterNames.Contains(m.GetCluster()) {
+					return true, nil
+				}
+				for _, c := range m.GetWeightedClusters().GetClusters() {
+					if clusterNames.Contains(c.GetName()) {
+						return true, nil
+					}
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// clusterLoadAssignment returns the endpoints of the cluster: the EDS assignment for its service
+// name, which defaults to the cluster name, or else its inline load assignment.
+func clusterLoadAssignment(c *envoycluster.Cluster, assignments map[string]*endpoint.ClusterLoadAssignment) *endpoint.ClusterLoadAssignment {
+	name := c.GetEdsClusterConfig().GetServiceName()
+	if name == "" {
+		name = c.GetName()
+	}
+	if cla, ok := assignments[name]; ok {
+		return cla
+	}
+	return c.GetLoadAssignment()
+}
@@ -0,0 +1,145 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	tcpproxy "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestHostConfig(t *testing.T) {
+	const (
+		foo     = "foo.ns.svc.cluster.local"
+		foo80   = "outbound|80||" + foo
+		foo80v1 = "outbound|80|v1|" + foo
+		foo9000 = "outbound|9000||" + foo
+		bar80   = "outbound|80||bar.ns.svc.cluster.local"
+	)
+	mustAny := func(m proto.Message) *anypb.Any {
+		a, err := anypb.New(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	filterListener := func(name string, filter proto.Message) *anypb.Any {
+		return mustAny(&listener.Listener{
+			Name: name,
+			FilterChains: []*listener.FilterChain{{Filters: []*listener.Filter{{
+				Name:       "filter",
+				ConfigType: &listener.Filter_TypedConfig{TypedConfig: mustAny(filter)},
+			}}}},
+		})
+	}
+	rc := &route.RouteConfiguration{Name: "80", VirtualHosts: []*route.VirtualHost{
+		{Name: foo + ":80", Domains: []string{foo, foo + ":80"}, Routes: []*route.Route{{
+			Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_WeightedClusters{
+				WeightedClusters: &route.WeightedCluster{Clusters: []*route.WeightedCluster_ClusterWeight{{Name: foo80}, {Name: foo80v1}}},
+			}}},
+		}}},
+		{Name: "bar", Domains: []string{"bar.ns.svc.cluster.local"}, Routes: []*route.Route{{
+			Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: bar80}}},
+		}}},
+	}}
+	cfg := &admin.ConfigDump{Configs: []*anypb.Any{
+		mustAny(&admin.ListenersConfigDump{DynamicListeners: []*admin.ListenersConfigDump_DynamicListener{
+			{ActiveState: &admin.ListenersConfigDump_DynamicListenerState{Listener: filterListener("0.0.0.0_80", &hcm.HttpConnectionManager{
+				RouteSpecifier: &hcm.HttpConnectionManager_Rds{Rds: &hcm.Rds{RouteConfigName: "80"}},
+			})}},
+			{ActiveState: &admin.ListenersConfigDump_DynamicListenerState{Listener: filterListener("0.0.0.0_9000", &tcpproxy.TcpProxy{
+				ClusterSpecifier: &tcpproxy.TcpProxy_Cluster{Cluster: foo9000},
+			})}},
+			{ActiveState: &admin.ListenersConfigDump_DynamicListenerState{Listener: filterListener("0.0.0.0_90", &tcpproxy.TcpProxy{
+				ClusterSpecifier: &tcpproxy.TcpProxy_Cluster{Cluster: bar80},
+			})}},
+		}}),
+		mustAny(&admin.RoutesConfigDump{DynamicRouteConfigs: []*admin.RoutesConfigDump_DynamicRouteConfig{{RouteConfig: mustAny(rc)}}}),
+		mustAny(&admin.ClustersConfigDump{DynamicActiveClusters: []*admin.ClustersConfigDump_DynamicCluster{
+			{Cluster: mustAny(&envoycluster.Cluster{Name: foo80})},
+			{Cluster: mustAny(&envoycluster.Cluster{Name: foo80v1})},
+			{Cluster: mustAny(&envoycluster.Cluster{Name: foo9000})},
+			{Cluster: mustAny(&envoycluster.Cluster{Name: bar80})},
+		}}),
+		mustAny(&admin.EndpointsConfigDump{DynamicEndpointConfigs: []*admin.EndpointsConfigDump_DynamicEndpointConfig{
+			{EndpointConfig: mustAny(&endpoint.ClusterLoadAssignment{ClusterName: foo80})},
+		}}),
+	}}
+
+	cases := []struct {
+		host          string
+		wantListeners []string
+		wantClusters  []string
+		wantEndpoints []string
+	}{
+		{
+			host:          foo + ":80",
+			wantListeners: []string{"0.0.0.0_80"},
+			wantClusters:  []string{foo80, foo80v1},
+			wantEndpoints: []string{foo80},
+		},
+		{
+			host:          foo,
+			wantListeners: []string{"0.0.0.0_80", "0.0.0.0_9000"},
+			wantClusters:  []string{foo80, foo80v1, foo9000},
+			wantEndpoints: []string{foo80},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.host, func(t *testing.T) {
+			got, err := ConfigForHost(cfg, tc.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var listeners, clusters, endpoints []string
+			for _, l := range got.Listeners {
+				listeners = append(listeners, l.GetName())
+			}
+			for _, c := range got.Clusters {
+				clusters = append(clusters, c.GetName())
+			}
+			for name := range got.Endpoints {
+				endpoints = append(endpoints, name)
+			}
+			sort.Strings(endpoints)
+			if !reflect.DeepEqual(listeners, tc.wantListeners) {
+				t.Errorf("got listeners %v, want %v", listeners, tc.wantListeners)
+			}
+			if !reflect.DeepEqual(clusters, tc.wantClusters) {
+				t.Errorf("got clusters %v, want %v", clusters, tc.wantClusters)
+			}
+			if !reflect.DeepEqual(endpoints, tc.wantEndpoints) {
+				t.Errorf("got endpoints %v, want %v", endpoints, tc.wantEndpoints)
+			}
+			if len(got.RouteConfigs) != 1 || got.VirtualHosts[0].GetName() != foo+":80" {
+				t.Errorf("unexpected routes %v", got.VirtualHosts)
+			}
+		})
+	}
+
+	if _, err := ConfigForHost(cfg, "missing.ns.svc.cluster.local"); err == nil {
+		t.Fatal("expected error for unreferenced host")
+	}
+}
@@ -16,12 +16,16 @@ package echo
 
 import (
 	"errors"
+	"fmt"
 	"sort"
+	"sync"
 
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
 	"github.com/hashicorp/go-multierror"
 
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/util/retry"
 )
 
 var _ Target = Instances{}
@@ -128,6 +132,70 @@ func (i Instances) MustWorkloads() Workloads {
 	return out
 }
 
+// ForEachSidecar calls fn with the sidecar of each workload of the instances. The calls run
+// concurrently, so fn must be safe for concurrent use. Workloads without a sidecar are skipped. All
+// sidecars are visited even if fn fails, and the returned error lists each proxy that failed.
+func (i Instances) ForEachSidecar(fn func(Sidecar) error) error {
+	type target struct {
+		name    string
+		sidecar Sidecar
+	}
+	var (
+		targets []target
+		errs    error
+	)
+	for _, inst := range i {
+		ws, err := inst.Workloads()
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed getting workloads for %s: %v", inst.Config().Service, err))
+			continue
+		}
+		for _, w := range ws {
+			if s := w.Sidecar(); s != nil {
+				targets = append(targets, target{name: inst.NamespaceName() + "/" + w.PodName(), sidecar: s})
+			}
+		}
+	}
+
+	results := make([]error, len(targets))
+	wg := sync.WaitGroup{}
+	for idx, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[idx] = fn(t.sidecar)
+		}()
+	}
+	wg.Wait()
+
+	for idx, t := range targets {
+		if results[idx] != nil {
+			errs = multierror.Append(errs, fmt.Errorf("proxy %s: %v", t.name, results[idx]))
+		}
+	}
+	return errs
+}
+
+// WaitForConfig waits for the sidecar of each workload of the instances to accept its config (see
+// Sidecar.WaitForConfig). The sidecars are waited on concurrently. Workloads without a sidecar are
+// skipped. The returned error lists each proxy that did not accept its config.
+func (i Instances) WaitForConfig(accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) error {
+	return i.ForEachSidecar(func(s Sidecar) error {
+		if err := s.WaitForConfig(accept, options...); err != nil {
+			return fmt.Errorf("did not accept config: %v", err)
+		}
+		return nil
+	})
+}
+
+// WaitForConfigOrFail calls WaitForConfig and fails the test if any proxy did not accept its config.
+func (i Instances) WaitForConfigOrFail(t test.Failer, accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) {
+	t.Helper()
+	if err := i.WaitForConfig(accept, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // IsDeployment returns true if there is only one deployment contained in the Instances
 func (i Instances) IsDeployment() bool {
 	return len(i.Services()) == 1
@@ -0,0 +1,128 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"strings"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+
+	"istio.io/istio/pkg/test/framework/components/echo"
+)
+
+// The functions in this file return accept handlers for Sidecar.WaitForConfig, for example:
+//
+//	sidecar.WaitForConfigOrFail(t, kube.HasClusterNamed("outbound|80||foo.ns.svc.cluster.local"))
+//
+// Handlers return false, rather than an error, when the config is not present yet, so that the
+// wait is retried.
+
+// HasListenerOnPort accepts a config dump with an active listener bound to the given port.
+func HasListenerOnPort(port int) func(*admin.ConfigDump) (bool, error) {
+	return func(cfg *admin.ConfigDump) (bool, error) {
+		listeners, err := echo.ListenerConfigurations(cfg)
+		if err != nil {
+			return false, err
+		}
+		for _, l := range listeners {
+			if int(l.GetAddress().GetSocketAddress().GetPortValue()) == port {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// HasClusterNamed accepts a config dump with the given cluster. As with echo.FindCluster, the name may
+// be a full cluster name or the FQDN of a service.
+func HasClusterNamed(name string) func(*admin.ConfigDump) (bool, error) {
+	return func(cfg *admin.ConfigDump) (bool, error) {
+		clusters, err := echo.ClusterConfigurations(cfg)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range clusters {
+			if c.GetName() == name || clusterHost(c.GetName()) == name {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// ClusterHasEndpoints accepts a config dump in which the named cluster has exactly n endpoints,
+// from EDS or else from the cluster's inline load assignment. Use it with
+// Sidecar.WaitForConfigWithEndpoints, since the config dump of WaitForConfig doesn't include EDS
+// endpoints.
+func ClusterHasEndpoints(name string, n int) func(*admin.ConfigDump) (bool, error) {
+	return func(cfg *admin.ConfigDump) (bool, error) {
+		assignments, err := echo.EndpointConfigurations(cfg)
+		if err != nil {
+			return false, err
+		}
+		if cla, ok := assignments[name]; ok {
+			return countEndpoints(cla) == n, nil
+		}
+		clusters, err := echo.ClusterConfigurations(cfg)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range clusters {
+			if c.GetName() == name {
+				return countEndpoints(c.GetLoadAssignment()) == n, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// HasRouteForHost accepts a config dump with a virtual host, in any route configuration, that
+// has the given domain.
+func HasRouteForHost(host string) func(*admin.ConfigDump) (bool, error) {
+	return func(cfg *admin.ConfigDump) (bool, error) {
+		rcs, err := echo.RouteConfigurations(cfg)
+		if err != nil {
+			return false, err
+		}
+		for _, rc := range rcs {
+			for _, vh := range rc.GetVirtualHosts() {
+				for _, d := range vh.GetDomains() {
+					if d == host {
+						return true, nil
+					}
+				}
+			}
+		}
+		return false, nil
+	}
+}
+
+// clusterHost returns the host of an outbound cluster name, or an empty string for other clusters.
+func clusterHost(name string) string {
+	parts := strings.Split(name, "|")
+	if len(parts) != 4 || parts[0] != "outbound" {
+		return ""
+	}
+	return parts[3]
+}
+
+func countEndpoints(cla *endpoint.ClusterLoadAssignment) int {
+	n := 0
+	for _, l := range cla.GetEndpoints() {
+		n += len(l.GetLbEndpoints())
+	}
+	return n
+}
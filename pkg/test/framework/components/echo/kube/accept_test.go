@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"testing"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestAcceptors(t *testing.T) {
+	mustAny := func(m proto.Message) *anypb.Any {
+		a, err := anypb.New(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	lbEndpoints := func(n int) []*endpoint.LocalityLbEndpoints {
+		return []*endpoint.LocalityLbEndpoints{{LbEndpoints: make([]*endpoint.LbEndpoint, n)}}
+	}
+	cfg := &admin.ConfigDump{Configs: []*anypb.Any{
+		mustAny(&admin.ListenersConfigDump{DynamicListeners: []*admin.ListenersConfigDump_DynamicListener{{
+			ActiveState: &admin.ListenersConfigDump_DynamicListenerState{Listener: mustAny(&listener.Listener{
+				Name: "0.0.0.0_8080",
+				Address: &core.Address{Address: &core.Address_SocketAddress{SocketAddress: &core.SocketAddress{
+					Address: "0.0.0.0", PortSpecifier: &core.SocketAddress_PortValue{PortValue: 8080},
+				}}},
+			})},
+		}}}),
+		mustAny(&admin.ClustersConfigDump{DynamicActiveClusters: []*admin.ClustersConfigDump_DynamicCluster{
+			{Cluster: mustAny(&envoycluster.Cluster{Name: "outbound|80||a.ns.svc.cluster.local"})},
+			{Cluster: mustAny(&envoycluster.Cluster{
+				Name:           "outbound|80||static.example.com",
+				LoadAssignment: &endpoint.ClusterLoadAssignment{Endpoints: lbEndpoints(1)},
+			})},
+		}}),
+		mustAny(&admin.EndpointsConfigDump{DynamicEndpointConfigs: []*admin.EndpointsConfigDump_DynamicEndpointConfig{{
+			EndpointConfig: mustAny(&endpoint.ClusterLoadAssignment{
+				ClusterName: "outbound|80||a.ns.svc.cluster.local",
+				Endpoints:   lbEndpoints(3),
+			}),
+		}}}),
+		mustAny(&admin.RoutesConfigDump{DynamicRouteConfigs: []*admin.RoutesConfigDump_DynamicRouteConfig{{
+			RouteConfig: mustAny(&route.RouteConfiguration{Name: "80", VirtualHosts: []*route.VirtualHost{{
+				Domains: []string{"a.ns.svc.cluster.local", "a.ns.svc.cluster.local:80"},
+			}}}),
+		}}}),
+	}}
+
+	cases := []struct {
+		name   string
+		accept func(*admin.ConfigDump) (bool, error)
+		want   bool
+	}{
+		{name: "listener port", accept: HasListenerOnPort(8080), want: true},
+		{name: "missing listener port", accept: HasListenerOnPort(9090), want: false},
+		{name: "cluster name", accept: HasClusterNamed("outbound|80||a.ns.svc.cluster.local"), want: true},
+		{name: "cluster fqdn", accept: HasClusterNamed("a.ns.svc.cluster.local"), want: true},
+		{name: "missing cluster", accept: HasClusterNamed("b.ns.svc.cluster.local"), want: false},
+		{name: "eds endpoints", accept: ClusterHasEndpoints("outbound|80||a.ns.svc.cluster.local", 3), want: true},
+		{name: "eds endpoints mismatch", accept: ClusterHasEndpoints("outbound|80||a.ns.svc.cluster.local", 2), want: false},
+		{name: "inline endpoints", accept: ClusterHasEndpoints("outbound|80||static.example.com", 1), want: true},
+		{name: "route host", accept: HasRouteForHost("a.ns.svc.cluster.local:80"), want: true},
+		{name: "missing route host", accept: HasRouteForHost("b.ns.svc.cluster.local"), want: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.accept(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	"github.com/hashicorp/go-multierror"
+
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+// ApplyAndWait applies the given YAML config to the namespace in the cluster and then waits for all
+// of the sidecars to accept the resulting Envoy configuration. The config is deleted when the test
+// context completes. The waits run concurrently, and the returned error reports the convergence
+// status of every proxy.
+func ApplyAndWait(ctx resource.Context, c cluster.Cluster, ns string, yaml string, sidecars []echo.Sidecar,
+	accept func(*admin.ConfigDump) (bool, error), options ...retry.Option,
+) error {
+	if err := ctx.ConfigKube(c).YAML(ns, yaml).Apply(); err != nil {
+		return fmt.Errorf("failed applying config to cluster %s: %v", c.Name(), err)
+	}
+
+	errs := make([]error, len(sidecars))
+	wg := sync.WaitGroup{}
+	for i, s := range sidecars {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.WaitForConfig(accept, options...)
+		}()
+	}
+	wg.Wait()
+
+	var (
+		converged []string
+		err       error
+	)
+	for i, s := range sidecars {
+		name := s.PodNamespace() + "/" + s.PodName()
+		if errs[i] != nil {
+			err = multierror.Append(err, fmt.Errorf("proxy %s did not converge: %v", name, errs[i]))
+			continue
+		}
+		converged = append(converged, name)
+	}
+	if err != nil {
+		return fmt.Errorf("%d/%d proxies converged [%s]: %v",
+			len(converged), len(sidecars), strings.Join(converged, ", "), err)
+	}
+	return nil
+}
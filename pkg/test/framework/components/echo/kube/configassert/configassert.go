@@ -0,0 +1,144 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configassert provides a fluent API for making assertions against the Envoy
+// configuration of a sidecar. For example:
+//
+//	configassert.On(sidecar).
+//		Cluster("outbound|80||foo.ns.svc.cluster.local").
+//		HasEndpoint("10.0.0.1").
+//		UsesMTLS().
+//		Check(t)
+//
+// Each step records a failure rather than stopping, so that all failures are reported together
+// by Check.
+package configassert
+
+import (
+	"fmt"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	"github.com/hashicorp/go-multierror"
+
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/test/framework/components/echo"
+)
+
+// Assertion accumulates checks against the Envoy configuration of a single sidecar. The config
+// dump used to select clusters is fetched lazily, at most once. The checks themselves use the
+// sidecar's queries, so they agree with what the sidecar reports.
+type Assertion struct {
+	sidecar echo.Sidecar
+
+	configDump *admin.ConfigDump
+
+	// clusterName is the name passed to Cluster, and cluster the full name of the cluster it
+	// selected, if it was found.
+	clusterName string
+	cluster     string
+
+	errs error
+}
+
+// On starts a chain of assertions against the given sidecar.
+func On(s echo.Sidecar) *Assertion {
+	return &Assertion{sidecar: s}
+}
+
+// Cluster selects the cluster that subsequent assertions apply to. The name may either be a full
+// cluster name (e.g. "outbound|80||foo.ns.svc.cluster.local") or the FQDN of a service, which is
+// resolved as by echo.FindCluster.
+func (a *Assertion) Cluster(name string) *Assertion {
+	a.clusterName, a.cluster = name, ""
+	cfg, err := a.config()
+	if err != nil {
+		return a.fail(err)
+	}
+	c, err := echo.FindCluster(cfg, name)
+	if err != nil {
+		return a.fail(err)
+	}
+	a.cluster = c.GetName()
+	return a
+}
+
+// HasEndpoint asserts that the selected cluster has an endpoint with the given IP address.
+func (a *Assertion) HasEndpoint(ip string) *Assertion {
+	if a.cluster == "" {
+		return a.failNoCluster("HasEndpoint")
+	}
+	eps, err := a.sidecar.GetEndpoints(a.cluster)
+	if err != nil {
+		return a.fail(fmt.Errorf("failed getting endpoints of cluster %s: %v", a.cluster, err))
+	}
+	for _, e := range eps {
+		if e.Address == ip {
+			return a
+		}
+	}
+	return a.fail(fmt.Errorf("cluster %s has no endpoint with address %s", a.cluster, ip))
+}
+
+// UsesMTLS asserts that the selected cluster originates mutual TLS, either always or through a
+// transport socket match (as used for Istio auto mTLS). See echo.Sidecar.IsMutualTLS.
+func (a *Assertion) UsesMTLS() *Assertion {
+	if a.cluster == "" {
+		return a.failNoCluster("UsesMTLS")
+	}
+	mtls, err := a.sidecar.IsMutualTLS(a.cluster)
+	if err != nil {
+		return a.fail(fmt.Errorf("cluster %s: %v", a.cluster, err))
+	}
+	if !mtls {
+		return a.fail(fmt.Errorf("cluster %s does not use mTLS", a.cluster))
+	}
+	return a
+}
+
+// Err returns the accumulated failures, or nil if all assertions passed.
+func (a *Assertion) Err() error {
+	return a.errs
+}
+
+// Check fails the test, reporting all accumulated failures, if any assertion failed.
+func (a *Assertion) Check(t test.Failer) {
+	t.Helper()
+	if a.errs != nil {
+		t.Fatal(a.errs)
+	}
+}
+
+func (a *Assertion) fail(err error) *Assertion {
+	a.errs = multierror.Append(a.errs, err)
+	return a
+}
+
+func (a *Assertion) failNoCluster(step string) *Assertion {
+	if a.clusterName == "" {
+		return a.fail(fmt.Errorf("%s: no cluster selected", step))
+	}
+	// The failure to find the cluster has already been recorded.
+	return a
+}
+
+func (a *Assertion) config() (*admin.ConfigDump, error) {
+	if a.configDump == nil {
+		cfg, err := a.sidecar.Config()
+		if err != nil {
+			return nil, fmt.Errorf("failed getting Envoy config: %v", err)
+		}
+		a.configDump = cfg
+	}
+	return a.configDump, nil
+}
@@ -0,0 +1,145 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configassert
+
+import (
+	"strings"
+	"testing"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/test/framework/components/echo/fake"
+)
+
+const (
+	mtlsCluster  = "outbound|80||foo.ns.svc.cluster.local"
+	plainCluster = "outbound|80||bar.ns.svc.cluster.local"
+)
+
+func mustAny(t *testing.T, m proto.Message) *anypb.Any {
+	t.Helper()
+	a, err := anypb.New(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func newFakeSidecar(t *testing.T) *fake.Sidecar {
+	mtls := &tls.UpstreamTlsContext{
+		CommonTlsContext: &tls.CommonTlsContext{
+			TlsCertificateSdsSecretConfigs: []*tls.SdsSecretConfig{{Name: "default"}},
+		},
+	}
+	clusters := &admin.ClustersConfigDump{
+		DynamicActiveClusters: []*admin.ClustersConfigDump_DynamicCluster{
+			{Cluster: mustAny(t, &envoycluster.Cluster{
+				Name: mtlsCluster,
+				TransportSocketMatches: []*envoycluster.Cluster_TransportSocketMatch{{
+					Name: "tlsMode-istio",
+					TransportSocket: &core.TransportSocket{
+						Name:       "envoy.transport_sockets.tls",
+						ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: mustAny(t, mtls)},
+					},
+				}},
+			})},
+			{Cluster: mustAny(t, &envoycluster.Cluster{Name: plainCluster})},
+		},
+	}
+	host := func(ip string) *admin.HostStatus {
+		return &admin.HostStatus{Address: &core.Address{Address: &core.Address_SocketAddress{
+			SocketAddress: &core.SocketAddress{Address: ip},
+		}}}
+	}
+	return &fake.Sidecar{
+		ConfigDump: &admin.ConfigDump{Configs: []*anypb.Any{mustAny(t, clusters)}},
+		ClusterStatuses: &admin.Clusters{ClusterStatuses: []*admin.ClusterStatus{
+			{Name: mtlsCluster, HostStatuses: []*admin.HostStatus{host("10.0.0.1")}},
+			{Name: plainCluster, HostStatuses: []*admin.HostStatus{host("10.0.0.2")}},
+		}},
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	s := newFakeSidecar(t)
+	cases := []struct {
+		name    string
+		assert  func(a *Assertion) *Assertion
+		wantErr []string
+	}{
+		{
+			name: "pass",
+			assert: func(a *Assertion) *Assertion {
+				return a.Cluster(mtlsCluster).HasEndpoint("10.0.0.1").UsesMTLS()
+			},
+		},
+		{
+			name: "pass by fqdn",
+			assert: func(a *Assertion) *Assertion {
+				return a.Cluster("bar.ns.svc.cluster.local").HasEndpoint("10.0.0.2")
+			},
+		},
+		{
+			name: "multiple failures",
+			assert: func(a *Assertion) *Assertion {
+				return a.Cluster(plainCluster).HasEndpoint("10.0.0.1").UsesMTLS()
+			},
+			wantErr: []string{
+				"cluster " + plainCluster + " has no endpoint with address 10.0.0.1",
+				"cluster " + plainCluster + " does not use mTLS",
+			},
+		},
+		{
+			name: "missing cluster",
+			assert: func(a *Assertion) *Assertion {
+				return a.Cluster("missing.ns.svc.cluster.local").HasEndpoint("10.0.0.1").UsesMTLS()
+			},
+			wantErr: []string{"1 error occurred", "cluster missing.ns.svc.cluster.local not found"},
+		},
+		{
+			name: "no cluster selected",
+			assert: func(a *Assertion) *Assertion {
+				return a.HasEndpoint("10.0.0.1")
+			},
+			wantErr: []string{"HasEndpoint: no cluster selected"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := tc.assert(On(s))
+			err := test.Wrap(a.Check)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
@@ -324,10 +324,15 @@ func deploymentParams(ctx resource.Context, cfg echo.Config, settings *resource.
 	}
 
 	containerPorts := getContainerPorts(cfg)
+	appImage := settings.EchoImage
+	if cfg.Image != "" {
+		appImage = cfg.Image
+	}
 	appContainers := []map[string]any{{
-		"Name":           appContainerName,
-		"ImageFullPath":  settings.EchoImage, // This overrides image hub/tag if it's not empty.
-		"ContainerPorts": containerPorts,
+		"Name":            appContainerName,
+		"ImageFullPath":   appImage, // This overrides image hub/tag if it's not empty.
+		"ImagePullPolicy": cfg.ImagePullPolicy,
+		"ContainerPorts":  containerPorts,
 	}}
 
 	// Only use the custom image for proxyless gRPC instances. This will bind the gRPC ports on one container
@@ -375,6 +380,7 @@ func deploymentParams(ctx resource.Context, cfg echo.Config, settings *resource.
 		"Cluster":                 cfg.Cluster.Name(),
 		"ReadinessTCPPort":        cfg.ReadinessTCPPort,
 		"ReadinessGRPCPort":       cfg.ReadinessGRPCPort,
+		"ReadinessInitialDelay":   readinessInitialDelaySeconds(cfg.ReadinessInitialDelay),
 		"StartupProbe":            supportStartupProbe,
 		"IncludeExtAuthz":         cfg.IncludeExtAuthz,
 		"Revisions":               settings.Revisions.TemplateMap(),
@@ -758,3 +764,13 @@ func deploymentComplete(deployment *appsv1.Deployment) bool {
 		deployment.Status.ReadyReplicas == *(deployment.Spec.Replicas) &&
 		deployment.Status.ObservedGeneration >= deployment.Generation
 }
+
+// readinessInitialDelaySeconds returns the initial delay of the readiness probe in whole seconds,
+// rounding up. The probe starts after at least one second.
+func readinessInitialDelaySeconds(d time.Duration) int64 {
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		return 1
+	}
+	return secs
+}
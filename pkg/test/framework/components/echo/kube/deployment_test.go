@@ -51,6 +51,23 @@ func TestDeploymentYAML(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:         "custom-image",
+			wantFilePath: "testdata/custom-image.yaml",
+			config: echo.Config{
+				Service:         "foo",
+				Image:           "testing.hub/app:pinned",
+				ImagePullPolicy: "IfNotPresent",
+				Ports: []echo.Port{
+					{
+						Name:         "http",
+						Protocol:     protocol.HTTP,
+						WorkloadPort: 8090,
+						ServicePort:  8090,
+					},
+				},
+			},
+		},
 		{
 			name:         "two-workloads-one-nosidecar",
 			wantFilePath: "testdata/two-workloads-one-nosidecar.yaml",
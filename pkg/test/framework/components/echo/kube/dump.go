@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"google.golang.org/protobuf/proto"
+
+	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/resource"
+	"istio.io/istio/pkg/util/protomarshal"
+)
+
+// DumpConfigOnFailure registers a cleanup that, if the test has failed, writes the debug bundle of
+// each sidecar (see Sidecar.DumpDebug), including its normalized config dump, to a per-pod
+// directory in the test's artifact directory. Sidecars are dumped in parallel, and a failure to
+// dump one sidecar does not prevent the others from being dumped. If t cannot report whether the
+// test failed, the dump is skipped and logged.
+func DumpConfigOnFailure(t test.Failer, sidecars ...echo.Sidecar) {
+	t.Cleanup(func() {
+		f, ok := t.(interface{ Failed() bool })
+		if !ok {
+			t.Logf("skipping proxy config dumps: %T does not report whether the test failed", t)
+			return
+		}
+		if !f.Failed() {
+			return
+		}
+		dir, err := proxyDumpDir(t)
+		if err != nil {
+			t.Logf("failed creating directory for proxy config dumps: %v", err)
+			return
+		}
+
+		errs := make([]error, len(sidecars))
+		wg := sync.WaitGroup{}
+		for i, s := range sidecars {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sdir := filepath.Join(dir, s.PodNamespace()+"_"+s.PodName())
+				if err := os.MkdirAll(sdir, 0o755); err != nil {
+					errs[i] = err
+					return
+				}
+				errs[i] = s.DumpDebug(sdir)
+			}()
+		}
+		wg.Wait()
+
+		for i, s := range sidecars {
+			if errs[i] != nil {
+				t.Logf("failed dumping config for proxy %s/%s: %v", s.PodNamespace(), s.PodName(), errs[i])
+			}
+		}
+		t.Logf("proxy config dumps written to %s", dir)
+	})
+}
+
+// proxyDumpDir returns the directory to write proxy dumps to. If the test is running within the
+// framework, this is in the test's artifact directory.
+func proxyDumpDir(t test.Failer) (string, error) {
+	if ctx, ok := t.(resource.Context); ok {
+		return ctx.CreateTmpDirectory("proxy-config")
+	}
+	return t.TempDir(), nil
+}
+
+func (s *sidecar) DumpDebug(dir string) error {
+	var err error
+	write := func(file string, get func() ([]byte, error)) {
+		out, gerr := get()
+		if gerr != nil {
+			err = multierror.Append(err, fmt.Errorf("failed getting %s: %v", file, gerr))
+			return
+		}
+		if werr := os.WriteFile(filepath.Join(dir, file), out, 0o644); werr != nil {
+			err = multierror.Append(err, fmt.Errorf("failed writing %s: %v", file, werr))
+		}
+	}
+	writeProto := func(file string, get func() (proto.Message, error)) {
+		write(file, func() ([]byte, error) {
+			msg, err := get()
+			if err != nil {
+				return nil, err
+			}
+			return protomarshal.MarshalIndentWithGlobalTypesResolver(msg, "  ")
+		})
+	}
+	writeText := func(file string, get func() (string, error)) {
+		write(file, func() ([]byte, error) {
+			out, err := get()
+			return []byte(out), err
+		})
+	}
+	write("config_dump.json", func() ([]byte, error) { return normalizedConfig(s) })
+	writeProto("clusters.json", func() (proto.Message, error) { return s.Clusters() })
+	writeProto("listeners.json", func() (proto.Message, error) { return s.Listeners() })
+	writeProto("server_info.json", func() (proto.Message, error) { return s.Info() })
+	writeText("stats.txt", func() (string, error) { return s.Raw("stats") })
+	writeText("proxy.log", s.Logs)
+	return err
+}
+
+// SnapshotAllConfigs writes the normalized config dump (see echo.NormalizeConfigDump) of each
+// workload with a sidecar in the instances to dir/<namespace>-<pod>.json, creating dir if needed.
+// Workloads are dumped in parallel, and a failure to dump one workload does not prevent the others
+// from being dumped. The returned error lists the pods that failed.
+func SnapshotAllConfigs(instances echo.Instances, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed creating snapshot directory %s: %v", dir, err)
+	}
+	return instances.ForEachSidecar(func(s echo.Sidecar) error {
+		out, err := normalizedConfig(s)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, s.PodNamespace()+"-"+s.PodName()+".json"), out, 0o644)
+	})
+}
+
+// normalizedConfig returns the config dump of the sidecar, normalized by echo.NormalizeConfigDump.
+func normalizedConfig(s echo.Sidecar) ([]byte, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	out, err := echo.NormalizeConfigDump(cfg)
+	return []byte(out), err
+}
@@ -15,56 +15,362 @@
 package kube
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	upstreamhttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	dto "github.com/prometheus/client_model/go"
 	"google.golang.org/protobuf/proto"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 
+	"istio.io/api/annotation"
+	meshconfig "istio.io/api/mesh/v1alpha1"
 	// Import all XDS config types
 	_ "istio.io/istio/pkg/config/xds"
+	istioKube "istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/framework/components/cluster"
 	"istio.io/istio/pkg/test/framework/components/echo"
 	"istio.io/istio/pkg/test/util/retry"
 	"istio.io/istio/pkg/util/protomarshal"
+	"istio.io/istio/pkg/util/sets"
 )
 
 const (
 	proxyContainerName = "istio-proxy"
 
+	// defaultExecAttempts is the default number of attempts for admin requests failing with
+	// transient exec errors.
+	defaultExecAttempts = 3
+
+	// defaultExecDelay the default delay between admin request attempts
+	defaultExecDelay = time.Millisecond * 200
+
+	// defaultAdminPort is the Envoy admin port used by curl admin requests if none is set.
+	defaultAdminPort = 15000
+
 	// DefaultTimeout the default timeout for the entire retry operation
 	defaultConfigTimeout = time.Second * 30
 
-	// DefaultDelay the default delay between successive retry attempts
+	// defaultConfigDelay is the initial delay between successive retry attempts. Waits use
+	// retry.BackoffDelay, so the delay doubles after each attempt up to 16x this value. The
+	// timeout bounds the whole wait, including the delays.
 	defaultConfigDelay = time.Millisecond * 100
+
+	// defaultLogsTimeout bounds reading the logs of the proxy container, so that a wedged log
+	// stream can't hang the test.
+	defaultLogsTimeout = time.Second * 30
+
+	// defaultConfigDelayJitter is the fraction by which the default delays are randomized when the
+	// caller of a wait passes no retry options (see waitUntil).
+	defaultConfigDelayJitter = 0.5
 )
 
 var _ echo.Sidecar = &sidecar{}
 
+// configDumpResourceTypes are the resource types that the config dump can be filtered to. These
+// are the repeated fields of the per-resource config dumps.
+var configDumpResourceTypes = sets.New(
+	"static_listeners", "dynamic_listeners",
+	"static_clusters", "dynamic_active_clusters", "dynamic_warming_clusters",
+	"static_route_configs", "dynamic_route_configs",
+	"static_scoped_route_configs", "dynamic_scoped_route_configs",
+	"static_endpoint_configs", "dynamic_endpoint_configs",
+	"static_secrets", "dynamic_active_secrets", "dynamic_warming_secrets",
+	"ecds_filters",
+)
+
+// defaultWaitOptions returns the default retry options for polling the sidecar. These may be
+// overridden by the caller's options. The default timeout still applies if the caller passes
+// retry.MaxAttempts; polling stops at whichever limit is reached first.
+func defaultWaitOptions() []retry.Option {
+	return []retry.Option{
+		retry.BackoffDelay(defaultConfigDelay),
+		retry.Timeout(defaultConfigTimeout),
+	}
+}
+
+// waitUntil calls retry.UntilComplete with the default wait options, overridden by options.
+//
+// If the caller passes no options, each sleep between attempts is jittered by
+// defaultConfigDelayJitter, so that many sidecars polled in parallel don't exec into their pods in
+// lockstep. The retry package sleeps for a fixed delay that doubles after each attempt, so it is
+// set to the low end of the jitter range and waitUntil sleeps for a random remainder before each
+// retry (see jitteredBackoff). Retry options can't be inspected, so a caller's delay and timeout
+// are used as they are, without jitter.
+func waitUntil(fn retry.RetriableFunc, options ...retry.Option) (any, error) {
+	if len(options) > 0 {
+		return retry.UntilComplete(fn, append(defaultWaitOptions(), options...)...)
+	}
+	b := &jitteredBackoff{
+		delay:    defaultConfigDelay,
+		fraction: defaultConfigDelayJitter,
+		deadline: time.Now().Add(defaultConfigTimeout),
+	}
+	attempts := 0
+	return retry.UntilComplete(func() (any, bool, error) {
+		if attempts > 0 {
+			time.Sleep(b.next())
+		}
+		attempts++
+		return fn()
+	}, retry.BackoffDelay(jitterFloor(defaultConfigDelay, defaultConfigDelayJitter)), retry.Timeout(defaultConfigTimeout))
+}
+
+// waitUntilSuccess is like waitUntil, retrying until fn succeeds.
+func waitUntilSuccess(fn func() error, options ...retry.Option) error {
+	_, err := waitUntil(func() (any, bool, error) {
+		if err := fn(); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	}, options...)
+	return err
+}
+
+// jitteredBackoff tracks the backoff delay of retry.BackoffDelay, which doubles after each attempt
+// up to 16x the initial delay. Added to the retry package's delay, which is the jitter floor of the
+// backoff delay, next returns a random remainder that spreads each sleep over the full jitter range.
+type jitteredBackoff struct {
+	delay    time.Duration
+	fraction float64
+	// deadline is when the retries time out. The remainder never sleeps past it.
+	deadline time.Time
+	attempt  int
+}
+
+// next returns the extra sleep before the next retry.
+func (b *jitteredBackoff) next() time.Duration {
+	d := b.delay << min(b.attempt, 4)
+	b.attempt++
+	extra := jitter(d, b.fraction) - jitterFloor(d, b.fraction)
+	return max(0, min(extra, time.Until(b.deadline)))
+}
+
+// jitter randomizes d by up to +/- the given fraction of d. The fraction is bounded to [0, 1], so
+// the result is never negative and never more than 2x d.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	fraction = math.Max(0, math.Min(1, fraction))
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
+
+// jitterFloor returns the lowest delay that jitter can return for d and the fraction.
+func jitterFloor(d time.Duration, fraction float64) time.Duration {
+	fraction = math.Max(0, math.Min(1, fraction))
+	return time.Duration(float64(d) * (1 - fraction))
+}
+
 type sidecar struct {
 	podNamespace string
 	podName      string
 	cluster      cluster.Cluster
+
+	// container running the proxy. Defaults to istio-proxy.
+	container string
+
+	// adminPort is the admin port of the Envoy instance to query. If zero, the default admin port
+	// of the pod's proxy is used.
+	adminPort int
+
+	// curl, if true, queries the admin port with curl rather than pilot-agent, for proxies that
+	// don't run pilot-agent.
+	curl bool
+
+	// curlFlags are extra flags passed to curl, such as --unix-socket.
+	curlFlags []string
+
+	// adminHeaders are headers added to admin requests made with curl or over the port-forward.
+	adminHeaders map[string]string
+
+	// execRetryOptions configure the retries of admin requests that fail with transient exec errors.
+	execRetryOptions []retry.Option
+
+	// forwarder, if set, is a port-forward to the admin port that admin requests are made through,
+	// using httpClient, rather than by exec-ing into the pod.
+	forwarder  istioKube.PortForwarder
+	httpClient *http.Client
+
+	// podCheck ensures the pod is looked up on the cluster once, before the first exec. podErr is
+	// set if the pod doesn't exist there, which is usually a sidecar created with the wrong cluster.
+	podCheck sync.Once
+	podErr   error
+}
+
+// SidecarOption configures a sidecar.
+type SidecarOption func(*sidecar)
+
+// WithAdminPort targets admin requests at the Envoy instance listening on the given admin port. This
+// is needed for pods running more than one Envoy, or proxies with a non-default admin port.
+func WithAdminPort(port int) SidecarOption {
+	return func(s *sidecar) {
+		s.adminPort = port
+	}
+}
+
+// WithContainer sets the name of the container running the proxy.
+func WithContainer(name string) SidecarOption {
+	return func(s *sidecar) {
+		s.container = name
+	}
+}
+
+// WithCurl makes admin requests with curl against the admin port (see WithAdminPort) rather than
+// with pilot-agent.
+func WithCurl() SidecarOption {
+	return func(s *sidecar) {
+		s.curl = true
+	}
+}
+
+// WithCurlFlags passes extra flags to curl, such as "--unix-socket" and a socket path for an admin
+// interface exposed on a unix domain socket. Implies WithCurl.
+func WithCurlFlags(flags ...string) SidecarOption {
+	return func(s *sidecar) {
+		s.curl = true
+		s.curlFlags = append(s.curlFlags, flags...)
+	}
+}
+
+// WithAdminHeaders adds headers to admin requests, for admin interfaces that require
+// authentication. pilot-agent can't send headers, so this implies WithCurl when admin requests are
+// made by exec-ing into the pod.
+func WithAdminHeaders(headers map[string]string) SidecarOption {
+	return func(s *sidecar) {
+		s.curl = true
+		if s.adminHeaders == nil {
+			s.adminHeaders = map[string]string{}
+		}
+		for k, v := range headers {
+			s.adminHeaders[k] = v
+		}
+	}
+}
+
+// WithExecRetry sets the retry options for admin requests that fail with transient exec errors,
+// such as the API server or kubelet being briefly unavailable. By default, a failed request is
+// attempted up to 3 times.
+func WithExecRetry(options ...retry.Option) SidecarOption {
+	return func(s *sidecar) {
+		s.execRetryOptions = options
+	}
+}
+
+// sidecarOptions returns the options for the sidecar of the pod. If the pod's proxy config annotation
+// overrides the admin port, admin requests are made against that port.
+func sidecarOptions(pod corev1.Pod) []SidecarOption {
+	pc, ok := pod.Annotations[annotation.ProxyConfig.Name]
+	if !ok {
+		return nil
+	}
+	cfg := &meshconfig.ProxyConfig{}
+	if err := protomarshal.ApplyYAML(pc, cfg); err != nil || cfg.GetProxyAdminPort() == 0 {
+		return nil
+	}
+	return []SidecarOption{WithAdminPort(int(cfg.GetProxyAdminPort()))}
+}
+
+// NewSidecar returns a Sidecar for querying the proxy in the given pod. By default, the proxy is
+// expected to run in the istio-proxy container and to be queried through pilot-agent. Use the
+// options to query other proxies, such as ztunnel or waypoints.
+func NewSidecar(pod corev1.Pod, cluster cluster.Cluster, opts ...SidecarOption) echo.Sidecar {
+	return newSidecar(pod, cluster, opts...)
 }
 
-func newSidecar(pod corev1.Pod, cluster cluster.Cluster) *sidecar {
+func newSidecar(pod corev1.Pod, cluster cluster.Cluster, opts ...SidecarOption) *sidecar {
 	sidecar := &sidecar{
 		podNamespace: pod.Namespace,
 		podName:      pod.Name,
 		cluster:      cluster,
+		container:    proxyContainerName,
+		execRetryOptions: []retry.Option{
+			retry.MaxAttempts(defaultExecAttempts), retry.BackoffDelay(defaultExecDelay), retry.Timeout(defaultConfigTimeout),
+		},
+	}
+	for _, o := range opts {
+		o(sidecar)
 	}
 
 	return sidecar
 }
 
+// NewSidecarViaPortForward returns a Sidecar that makes admin requests over a single port-forward to
+// the proxy's admin port, rather than exec-ing into the pod for each request. This is much cheaper
+// for tests that poll the proxy many times. The returned Closer closes the port-forward.
+func NewSidecarViaPortForward(pod corev1.Pod, cluster cluster.Cluster, opts ...SidecarOption) (echo.Sidecar, io.Closer, error) {
+	s, err := newSidecarViaPortForward(pod, cluster, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, s, nil
+}
+
+func newSidecarViaPortForward(pod corev1.Pod, cluster cluster.Cluster, opts ...SidecarOption) (*sidecar, error) {
+	s := newSidecar(pod, cluster, opts...)
+	if err := s.checkPod(context.Background()); err != nil {
+		return nil, err
+	}
+	port := s.adminPort
+	if port == 0 {
+		port = defaultAdminPort
+	}
+	forwarder, err := cluster.NewPortForwarder(pod.Name, pod.Namespace, "", 0, port)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating port forwarder for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	if err := forwarder.Start(); err != nil {
+		return nil, fmt.Errorf("failed starting port forwarder for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+	s.forwarder = forwarder
+	s.httpClient = &http.Client{Timeout: defaultConfigTimeout}
+	return s, nil
+}
+
+// Close closes the port-forward of the sidecar, if any.
+func (s *sidecar) Close() error {
+	if s.forwarder != nil {
+		s.forwarder.Close()
+	}
+	return nil
+}
+
+func (s *sidecar) PodName() string {
+	return s.podName
+}
+
+func (s *sidecar) PodNamespace() string {
+	return s.podNamespace
+}
+
+func (s *sidecar) Cluster() cluster.Cluster {
+	return s.cluster
+}
+
 func (s *sidecar) Info() (*admin.ServerInfo, error) {
+	return s.InfoContext(context.Background())
+}
+
+func (s *sidecar) InfoContext(ctx context.Context) (*admin.ServerInfo, error) {
 	msg := &admin.ServerInfo{}
-	if err := s.adminRequest("server_info", msg); err != nil {
+	if err := s.adminRequest(ctx, "server_info", msg); err != nil {
 		return nil, err
 	}
 
@@ -80,15 +386,146 @@ func (s *sidecar) InfoOrFail(t test.Failer) *admin.ServerInfo {
 	return info
 }
 
+func (s *sidecar) Ready() (bool, error) {
+	info, err := s.Info()
+	if err != nil {
+		return false, err
+	}
+	return info.GetState() == admin.ServerInfo_LIVE, nil
+}
+
+func (s *sidecar) WaitUntilReady(options ...retry.Option) error {
+	if err := s.waitForState(admin.ServerInfo_LIVE, options...); err != nil {
+		return fmt.Errorf("failed waiting for Envoy to be ready, %v", err)
+	}
+	return nil
+}
+
+func (s *sidecar) Drain(opts echo.DrainOptions) error {
+	path := "drain_listeners"
+	if opts.Graceful {
+		path += "?graceful"
+	}
+	return s.adminPost(path)
+}
+
+func (s *sidecar) WaitForDraining(options ...retry.Option) error {
+	if err := s.waitForState(admin.ServerInfo_DRAINING, options...); err != nil {
+		return fmt.Errorf("failed waiting for Envoy to drain, %v", err)
+	}
+	return nil
+}
+
+func (s *sidecar) Quit() error {
+	return s.adminPost("quitquitquit")
+}
+
+// waitForState polls the Envoy server state until it is the given state. The returned error
+// includes the last observed state.
+func (s *sidecar) waitForState(want admin.ServerInfo_State, options ...retry.Option) error {
+	var state *admin.ServerInfo_State
+	err := waitUntilSuccess(func() error {
+		info, err := s.Info()
+		if err != nil {
+			return err
+		}
+		st := info.GetState()
+		state = &st
+		if st != want {
+			return fmt.Errorf("server state is %s", st)
+		}
+		return nil
+	}, options...)
+	if err != nil {
+		if state == nil {
+			return fmt.Errorf("state was never observed: %v", err)
+		}
+		return fmt.Errorf("last observed state %s: %v", *state, err)
+	}
+	return nil
+}
+
+func (s *sidecar) Memory() (*admin.Memory, error) {
+	msg := &admin.Memory{}
+	if err := s.adminRequest(context.Background(), "memory", msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *sidecar) MemoryOrFail(t test.Failer) *admin.Memory {
+	t.Helper()
+	mem, err := s.Memory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mem
+}
+
+func (s *sidecar) Runtime() (*echo.Runtime, error) {
+	// There is no proto for the runtime admin response, so it is parsed as plain JSON.
+	out, err := s.adminRequestRaw(context.Background(), "runtime")
+	if err != nil {
+		return nil, err
+	}
+	rt := &echo.Runtime{}
+	if err := json.Unmarshal([]byte(out), rt); err != nil {
+		return nil, fmt.Errorf("failed parsing Envoy admin response from '/runtime': %v\nResponse JSON: %s", err, out)
+	}
+
+	return rt, nil
+}
+
+func (s *sidecar) RuntimeOrFail(t test.Failer) *echo.Runtime {
+	t.Helper()
+	rt, err := s.Runtime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+func (s *sidecar) HotRestartVersion() (string, error) {
+	out, err := s.adminRequestRaw(context.Background(), "hot_restart_version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (s *sidecar) HotRestartVersionOrFail(t test.Failer) string {
+	t.Helper()
+	v, err := s.HotRestartVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
 func (s *sidecar) Config() (*admin.ConfigDump, error) {
+	return s.ConfigContext(context.Background())
+}
+
+func (s *sidecar) ConfigContext(ctx context.Context) (*admin.ConfigDump, error) {
 	msg := &admin.ConfigDump{}
-	if err := s.adminRequest("config_dump", msg); err != nil {
+	if err := s.adminRequest(ctx, "config_dump", msg); err != nil {
 		return nil, err
 	}
 
 	return msg, nil
 }
 
+// configWithEndpoints returns the config dump including the EDS endpoints, which are only dumped
+// on request.
+func (s *sidecar) configWithEndpoints(ctx context.Context) (*admin.ConfigDump, error) {
+	msg := &admin.ConfigDump{}
+	if err := s.adminRequest(ctx, "config_dump?include_eds", msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
 func (s *sidecar) ConfigOrFail(t test.Failer) *admin.ConfigDump {
 	t.Helper()
 	cfg, err := s.Config()
@@ -98,22 +535,65 @@ func (s *sidecar) ConfigOrFail(t test.Failer) *admin.ConfigDump {
 	return cfg
 }
 
+func (s *sidecar) Bootstrap() (*admin.BootstrapConfigDump, error) {
+	// The bootstrap isn't a repeated field, so it can't be selected with config_dump?resource.
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return echo.BootstrapConfigDump(cfg)
+}
+
+func (s *sidecar) ConfigForType(resourceType string) (*admin.ConfigDump, error) {
+	if !configDumpResourceTypes.Contains(resourceType) {
+		return nil, fmt.Errorf("unknown config dump resource type %q, must be one of %v",
+			resourceType, sets.SortedList(configDumpResourceTypes))
+	}
+	path := "config_dump?resource=" + resourceType
+	if strings.HasSuffix(resourceType, "_endpoint_configs") {
+		// Endpoints are only included in the config dump on request.
+		path += "&include_eds"
+	}
+	msg := &admin.ConfigDump{}
+	if err := s.adminRequest(context.Background(), path, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *sidecar) BootstrapOrFail(t test.Failer) *admin.BootstrapConfigDump {
+	t.Helper()
+	b, err := s.Bootstrap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
 func (s *sidecar) WaitForConfig(accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) error {
-	options = append([]retry.Option{retry.BackoffDelay(defaultConfigDelay), retry.Timeout(defaultConfigTimeout)}, options...)
+	return s.waitForConfig(s.Config, accept, options...)
+}
+
+func (s *sidecar) WaitForConfigWithEndpoints(accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) error {
+	return s.waitForConfig(func() (*admin.ConfigDump, error) {
+		return s.configWithEndpoints(context.Background())
+	}, accept, options...)
+}
 
+// waitForConfig polls the config dump returned by fetch until it is accepted. See WaitForConfig.
+func (s *sidecar) waitForConfig(fetch func() (*admin.ConfigDump, error),
+	accept func(*admin.ConfigDump) (bool, error), options ...retry.Option,
+) error {
 	var cfg *admin.ConfigDump
-	_, err := retry.UntilComplete(func() (result any, completed bool, err error) {
-		cfg, err = s.Config()
+	res, err := waitUntil(func() (result any, completed bool, err error) {
+		cfg, err = fetch()
 		if err != nil {
-			if strings.Contains(err.Error(), "could not resolve Any message type") {
-				// Unable to parse an Any in the message, likely due to missing imports.
-				// This is not a recoverable error.
-				return nil, true, nil
-			}
-			if strings.Contains(err.Error(), `Any JSON doesn't have '@type'`) {
-				// Unable to parse an Any in the message, likely due to an older version.
-				// This is not a recoverable error.
-				return nil, true, nil
+			if errors.Is(err, echo.ErrUnresolvedAnyType) {
+				// This is not a recoverable error. Complete with the error as the result, since
+				// completing with an error would be retried.
+				return err, true, nil
 			}
 			return nil, false, err
 		}
@@ -132,6 +612,9 @@ func (s *sidecar) WaitForConfig(accept func(*admin.ConfigDump) (bool, error), op
 		// The configuration was rejected, don't try again.
 		return nil, true, errors.New("envoy config rejected")
 	}, options...)
+	if err == nil && res != nil {
+		return res.(error)
+	}
 	if err != nil {
 		configDumpStr := "nil"
 		if cfg != nil {
@@ -146,6 +629,32 @@ func (s *sidecar) WaitForConfig(accept func(*admin.ConfigDump) (bool, error), op
 	return nil
 }
 
+func (s *sidecar) ConfigDiff(before, after *admin.ConfigDump) (string, error) {
+	return echo.ConfigDiff(before, after)
+}
+
+func (s *sidecar) WaitForConfigAll(accepts []func(*admin.ConfigDump) (bool, error), options ...retry.Option) error {
+	return s.WaitForConfig(func(cfg *admin.ConfigDump) (bool, error) {
+		for i, accept := range accepts {
+			accepted, err := accept(cfg)
+			if err != nil {
+				return false, fmt.Errorf("accept handler %d: %v", i, err)
+			}
+			if !accepted {
+				return false, nil
+			}
+		}
+		return true, nil
+	}, options...)
+}
+
+func (s *sidecar) WaitForConfigAllOrFail(t test.Failer, accepts []func(*admin.ConfigDump) (bool, error), options ...retry.Option) {
+	t.Helper()
+	if err := s.WaitForConfigAll(accepts, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func (s *sidecar) WaitForConfigOrFail(t test.Failer, accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) {
 	t.Helper()
 	if err := s.WaitForConfig(accept, options...); err != nil {
@@ -153,9 +662,42 @@ func (s *sidecar) WaitForConfigOrFail(t test.Failer, accept func(*admin.ConfigDu
 	}
 }
 
+func (s *sidecar) ConfigVersion() (map[string]string, error) {
+	msg, err := s.configWithEndpoints(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return echo.ConfigVersions(msg)
+}
+
+func (s *sidecar) WaitForConfigVersionChange(previous map[string]string, options ...retry.Option) error {
+	return waitUntilSuccess(func() error {
+		current, err := s.ConfigVersion()
+		if err != nil {
+			return err
+		}
+		if maps.Equal(previous, current) {
+			return fmt.Errorf("config version unchanged: %v", current)
+		}
+		return nil
+	}, options...)
+}
+
+func (s *sidecar) ConfigForHost(host string) (*echo.HostConfig, error) {
+	msg, err := s.configWithEndpoints(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return echo.ConfigForHost(msg, host)
+}
+
 func (s *sidecar) Clusters() (*admin.Clusters, error) {
+	return s.ClustersContext(context.Background())
+}
+
+func (s *sidecar) ClustersContext(ctx context.Context) (*admin.Clusters, error) {
 	msg := &admin.Clusters{}
-	if err := s.adminRequest("clusters?format=json", msg); err != nil {
+	if err := s.adminRequest(ctx, "clusters?format=json", msg); err != nil {
 		return nil, err
 	}
 
@@ -171,48 +713,720 @@ func (s *sidecar) ClustersOrFail(t test.Failer) *admin.Clusters {
 	return clusters
 }
 
-func (s *sidecar) Listeners() (*admin.Listeners, error) {
-	msg := &admin.Listeners{}
-	if err := s.adminRequest("listeners?format=json", msg); err != nil {
+func (s *sidecar) GetEndpoints(cluster string) ([]echo.ClusterEndpoint, error) {
+	clusters, err := s.Clusters()
+	if err != nil {
 		return nil, err
 	}
-
-	return msg, nil
+	return echo.EndpointsForCluster(clusters, cluster), nil
 }
 
-func (s *sidecar) ListenersOrFail(t test.Failer) *admin.Listeners {
-	t.Helper()
-	listeners, err := s.Listeners()
+func (s *sidecar) WaitForHealthyEndpoints(cluster string, min int, options ...retry.Option) error {
+	var last []echo.ClusterEndpoint
+	err := waitUntilSuccess(func() error {
+		eps, err := s.GetEndpoints(cluster)
+		if err != nil {
+			return err
+		}
+		last = eps
+		if healthy := countHealthyEndpoints(eps); healthy < min {
+			return fmt.Errorf("cluster %s has %d healthy endpoints, want at least %d", cluster, healthy, min)
+		}
+		return nil
+	}, options...)
 	if err != nil {
-		t.Fatal(err)
+		return fmt.Errorf("failed waiting for healthy endpoints: %v\nEndpoints of cluster %s:\n%s",
+			err, cluster, echo.FormatEndpoints(last))
 	}
-	return listeners
+	return nil
 }
 
-func (s *sidecar) adminRequest(path string, out proto.Message) error {
-	// Exec onto the pod and make a curl request to the admin port, writing
-	command := fmt.Sprintf("pilot-agent request GET %s", path)
-	stdout, stderr, err := s.cluster.PodExec(s.podName, s.podNamespace, proxyContainerName, command)
-	if err != nil {
-		return fmt.Errorf("failed exec on pod %s/%s: %v. Command: %s. Output:\n%s",
-			s.podNamespace, s.podName, err, command, stdout+stderr)
+func countHealthyEndpoints(eps []echo.ClusterEndpoint) int {
+	n := 0
+	for _, e := range eps {
+		if e.Healthy() {
+			n++
+		}
 	}
+	return n
+}
 
-	if err := protomarshal.UnmarshalAllowUnknown([]byte(stdout), out); err != nil {
-		return fmt.Errorf("failed parsing Envoy admin response from '/%s': %v\nResponse JSON: %s", path, err, stdout)
-	}
-	return nil
+func (s *sidecar) ClustersText() (string, error) {
+	return s.adminRequestRaw(context.Background(), "clusters")
 }
 
-func (s *sidecar) Logs() (string, error) {
-	return s.cluster.PodLogs(context.TODO(), s.podName, s.podNamespace, proxyContainerName, false)
+func (s *sidecar) ListenersText() (string, error) {
+	return s.adminRequestRaw(context.Background(), "listeners")
 }
 
-func (s *sidecar) LogsOrFail(t test.Failer) string {
+func (s *sidecar) Listeners() (*admin.Listeners, error) {
+	return s.ListenersContext(context.Background())
+}
+
+func (s *sidecar) ListenersContext(ctx context.Context) (*admin.Listeners, error) {
+	msg := &admin.Listeners{}
+	if err := s.adminRequest(ctx, "listeners?format=json", msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *sidecar) ListenersOrFail(t test.Failer) *admin.Listeners {
 	t.Helper()
-	logs, err := s.Logs()
+	listeners, err := s.Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listeners
+}
+
+func (s *sidecar) WaitForListeners(accept func(*admin.Listeners) (bool, error), options ...retry.Option) error {
+	var listeners *admin.Listeners
+	_, err := waitUntil(func() (result any, completed bool, err error) {
+		listeners, err = s.Listeners()
+		if err != nil {
+			return nil, false, err
+		}
+
+		accepted, err := accept(listeners)
+		if err != nil {
+			// Accept returned an error - retry.
+			return nil, false, err
+		}
+
+		if accepted {
+			// The listeners were accepted.
+			return nil, true, nil
+		}
+
+		// The listeners were rejected, don't try again.
+		return nil, true, errors.New("envoy listeners rejected")
+	}, options...)
+	if err != nil {
+		listenersStr := "nil"
+		if listeners != nil {
+			b, err := protomarshal.MarshalIndent(listeners, "  ")
+			if err == nil {
+				listenersStr = string(b)
+			}
+		}
+
+		return fmt.Errorf("failed waiting for Envoy listeners: %v. Last listeners:\n%s", err, listenersStr)
+	}
+	return nil
+}
+
+func (s *sidecar) WaitForListenersOrFail(t test.Failer, accept func(*admin.Listeners) (bool, error), options ...retry.Option) {
+	t.Helper()
+	if err := s.WaitForListeners(accept, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *sidecar) Certs() (*admin.Certificates, error) {
+	return s.CertsContext(context.Background())
+}
+
+func (s *sidecar) CertsContext(ctx context.Context) (*admin.Certificates, error) {
+	// Before SDS has pushed certificates, the ca_cert and cert_chain arrays are empty, which parses
+	// to certificates with no details.
+	msg := &admin.Certificates{}
+	if err := s.adminRequest(ctx, "certs", msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func (s *sidecar) CertsOrFail(t test.Failer) *admin.Certificates {
+	t.Helper()
+	certs, err := s.Certs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certs
+}
+
+func (s *sidecar) Secrets() (*admin.SecretsConfigDump, error) {
+	// Filtering the config dump by secret resource type returns the individual secrets, without
+	// the static and warming sections, so the full config dump is used.
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.SecretsConfigDump(cfg)
+}
+
+func (s *sidecar) SecretsOrFail(t test.Failer) *admin.SecretsConfigDump {
+	t.Helper()
+	secrets, err := s.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secrets
+}
+
+func (s *sidecar) HTTPConnectionPool(fqdn string) (*upstreamhttp.HttpProtocolOptions, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.HTTPConnectionPool(cfg, fqdn)
+}
+
+func (s *sidecar) HealthChecks(fqdn string) ([]*core.HealthCheck, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.HealthChecks(cfg, fqdn)
+}
+
+func (s *sidecar) LoadBalancerPolicy(fqdn string) (envoycluster.Cluster_LbPolicy, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return envoycluster.Cluster_ROUND_ROBIN, err
+	}
+	return echo.LoadBalancerPolicy(cfg, fqdn)
+}
+
+func (s *sidecar) LoadBalancerHash(fqdn string) (*echo.LoadBalancerHash, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.LoadBalancerHashConfig(cfg, fqdn)
+}
+
+func (s *sidecar) UpstreamTLSSANs(fqdn string) ([]string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.UpstreamTLSSANs(cfg, fqdn)
+}
+
+func (s *sidecar) IsMutualTLS(fqdn string) (bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return false, err
+	}
+	return echo.IsMutualTLS(cfg, fqdn)
+}
+
+func (s *sidecar) ListenerFilters(port uint32) ([]string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.ListenerFilters(cfg, port)
+}
+
+func (s *sidecar) Locality() (string, string, string, error) {
+	b, err := s.Bootstrap()
+	if err != nil {
+		return "", "", "", err
+	}
+	l := b.GetBootstrap().GetNode().GetLocality()
+	return l.GetRegion(), l.GetZone(), l.GetSubZone(), nil
+}
+
+func (s *sidecar) ListenerSummary() (int, int, int, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return echo.ListenerSummary(cfg)
+}
+
+func (s *sidecar) RoutedHosts(routeConfigName string) ([]string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.RoutedHosts(cfg, routeConfigName)
+}
+
+func (s *sidecar) RouteMirrorPolicies(routeName string) ([]*route.RouteAction_RequestMirrorPolicy, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	return echo.RouteMirrorPolicies(cfg, routeName)
+}
+
+func (s *sidecar) FilterPresentInContext(context string, filterName string) (bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return false, err
+	}
+	return echo.FilterPresentInContext(cfg, context, filterName)
+}
+
+func (s *sidecar) CompressionConfig(port uint32) (proto.Message, bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, false, err
+	}
+	return echo.CompressionConfig(cfg, port)
+}
+
+func (s *sidecar) MatchRoute(host string, path string, headers map[string]string) (string, bool, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return "", false, err
+	}
+	return echo.MatchRoute(cfg, host, path, headers)
+}
+
+func (s *sidecar) WaitForStatAtLeast(name string, min float64, options ...retry.Option) error {
+	if err := s.WaitForStat(name, func(v uint64) bool { return float64(v) >= min }, options...); err != nil {
+		return fmt.Errorf("stat %s did not reach %v: %v", name, min, err)
+	}
+	return nil
+}
+
+func (s *sidecar) WaitForStat(name string, predicate func(uint64) bool, options ...retry.Option) error {
+	var (
+		last     uint64
+		observed bool
+	)
+	err := waitUntilSuccess(func() error {
+		stats, err := s.Stats()
+		if err != nil {
+			return err
+		}
+		v, ok := stats[name]
+		if !ok {
+			return fmt.Errorf("stat %s not found", name)
+		}
+		last, observed = v, true
+		if !predicate(v) {
+			return fmt.Errorf("stat %s is %d, not yet accepted", name, v)
+		}
+		return nil
+	}, options...)
+	if err != nil {
+		if !observed {
+			return fmt.Errorf("failed waiting for stat %s, stat was never observed: %v", name, err)
+		}
+		return fmt.Errorf("failed waiting for stat %s, last observed value %d: %v", name, last, err)
+	}
+	return nil
+}
+
+func (s *sidecar) Stats() (map[string]uint64, error) {
+	return s.StatsContext(context.Background())
+}
+
+func (s *sidecar) StatsContext(ctx context.Context) (map[string]uint64, error) {
+	out, err := s.adminRequestRaw(ctx, "stats?format=json")
+	if err != nil {
+		return nil, err
+	}
+
+	// Counters and gauges are reported as {"name": ..., "value": ...}. Histograms are reported
+	// as a single {"histograms": ...} entry, which is skipped.
+	var resp struct {
+		Stats []struct {
+			Name  string  `json:"name"`
+			Value *uint64 `json:"value"`
+		} `json:"stats"`
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		return nil, fmt.Errorf("failed parsing Envoy stats: %v", err)
+	}
+	stats := make(map[string]uint64, len(resp.Stats))
+	for _, st := range resp.Stats {
+		if st.Name == "" || st.Value == nil {
+			continue
+		}
+		stats[st.Name] = *st.Value
+	}
+	return stats, nil
+}
+
+func (s *sidecar) PrometheusStats() (map[string]*dto.MetricFamily, error) {
+	out, err := s.adminRequestRaw(context.Background(), "stats/prometheus")
+	if err != nil {
+		return nil, err
+	}
+	families, err := echo.ParsePrometheusStats(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing Envoy Prometheus stats: %v", err)
+	}
+	return families, nil
+}
+
+func (s *sidecar) ResetStats() error {
+	return s.adminPost("reset_counters")
+}
+
+func (s *sidecar) StatsOrFail(t test.Failer) map[string]uint64 {
+	t.Helper()
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func (s *sidecar) adminRequest(ctx context.Context, path string, out proto.Message) error {
+	stdout, err := s.adminRequestRaw(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if err := protomarshal.UnmarshalAllowUnknown([]byte(stdout), out); err != nil {
+		if isUnresolvedAnyError(err) {
+			return fmt.Errorf("%w: failed parsing Envoy admin response from '/%s': %v", echo.ErrUnresolvedAnyType, path, err)
+		}
+		return fmt.Errorf("failed parsing Envoy admin response from '/%s': %v\nResponse JSON: %s", path, err, stdout)
+	}
+	return nil
+}
+
+// adminRequestRaw makes a GET request to the Envoy admin endpoint and returns the response body.
+func (s *sidecar) adminRequestRaw(ctx context.Context, path string) (string, error) {
+	return s.adminExec(ctx, "GET", path)
+}
+
+// adminPost makes a POST request to the Envoy admin endpoint, ignoring the response body.
+func (s *sidecar) adminPost(path string) error {
+	_, err := s.adminExec(context.Background(), "POST", path)
+	return err
+}
+
+// adminExec makes a request with the given method to the Envoy admin endpoint and returns the
+// response body.
+func (s *sidecar) adminExec(ctx context.Context, method, path string) (string, error) {
+	if s.forwarder != nil {
+		return s.adminHTTP(ctx, method, path)
+	}
+
+	if err := s.checkPod(ctx); err != nil {
+		return "", err
+	}
+
+	// Exec onto the pod and make a request to the admin port, with pilot-agent or curl.
+	format, args := s.adminCommand(method, path)
+
+	var stdout, stderr string
+	// Transient exec failures are retried. Any other error completes the retry, and is returned as
+	// the result since UntilComplete would otherwise keep retrying it.
+	res, err := retry.UntilComplete(func() (any, bool, error) {
+		var err error
+		stdout, stderr, err = cluster.ExecFormatted(ctx, s.cluster, s.podName, s.podNamespace, s.container, format, args...)
+		if err != nil && ctx.Err() == nil && isTransientExecError(err) {
+			return nil, false, err
+		}
+		return err, true, nil
+	}, s.execRetryOptions...)
+	if err == nil && res != nil {
+		err = res.(error)
+	}
+	if err != nil {
+		command, _ := cluster.FormatArgs(format, args...)
+		return "", fmt.Errorf("failed exec on pod %s/%s: %v. Command: %s.%s",
+			s.podNamespace, s.podName, err, strings.Join(command, " "), execOutput(stdout, stderr))
+	}
+	return stdout, nil
+}
+
+// execOutput formats the output of a failed exec for an error, with stdout and stderr in separate
+// sections. With curl, for instance, stdout is the response body, such as an Envoy error page,
+// while stderr is the transport error. Empty streams are omitted.
+func execOutput(stdout, stderr string) string {
+	var out strings.Builder
+	if stdout != "" {
+		out.WriteString("\nStdout:\n" + stdout)
+	}
+	if stderr != "" {
+		out.WriteString("\nStderr:\n" + stderr)
+	}
+	return out.String()
+}
+
+// checkPod returns an error if the pod doesn't exist on the sidecar's cluster. In multicluster
+// tests, exec-ing against the wrong cluster otherwise fails with a confusing error from its API
+// server. The pod is only looked up once, and errors other than the pod not being found are
+// ignored, leaving them to the exec.
+func (s *sidecar) checkPod(ctx context.Context) error {
+	s.podCheck.Do(func() {
+		_, err := s.cluster.Kube().CoreV1().Pods(s.podNamespace).Get(ctx, s.podName, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			s.podErr = fmt.Errorf("pod %s/%s not found on cluster %s", s.podNamespace, s.podName, s.cluster.Name())
+		}
+	})
+	return s.podErr
+}
+
+// adminCommand returns the format and arguments (see cluster.FormatArgs) of the command that makes
+// an admin request from within the pod.
+func (s *sidecar) adminCommand(method, path string) (string, []any) {
+	if !s.curl {
+		format, args := "pilot-agent request %s %s", []any{method, path}
+		if s.adminPort != 0 {
+			format, args = format+" --debug-port %d", append(args, s.adminPort)
+		}
+		return format, args
+	}
+	port := s.adminPort
+	if port == 0 {
+		port = defaultAdminPort
+	}
+	// --fail-with-body makes curl exit non-zero on an error status, such as an Envoy 404 page,
+	// rather than returning the page as the response.
+	format, args := "curl -sS --fail-with-body -X %s", []any{method}
+	headers := make([]string, 0, len(s.adminHeaders))
+	for k := range s.adminHeaders {
+		headers = append(headers, k)
+	}
+	sort.Strings(headers)
+	for _, k := range headers {
+		format, args = format+" -H %s", append(args, k+": "+s.adminHeaders[k])
+	}
+	for _, f := range s.curlFlags {
+		format, args = format+" %s", append(args, f)
+	}
+	return format + " http://localhost:%d/%s", append(args, port, path)
+}
+
+// adminHTTP makes a request with the given method to the Envoy admin endpoint over the sidecar's
+// port-forward and returns the response body.
+func (s *sidecar) adminHTTP(ctx context.Context, method, path string) (string, error) {
+	url := fmt.Sprintf("http://%s/%s", s.forwarder.Address(), path)
+	var body string
+	res, err := retry.UntilComplete(func() (any, bool, error) {
+		var err error
+		body, err = s.doAdminHTTP(ctx, method, url)
+		if err != nil && ctx.Err() == nil && isTransientExecError(err) {
+			return nil, false, err
+		}
+		return err, true, nil
+	}, s.execRetryOptions...)
+	if err == nil && res != nil {
+		err = res.(error)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed admin request to pod %s/%s: %v. Request: %s %s",
+			s.podNamespace, s.podName, err, method, url)
+	}
+	return body, nil
+}
+
+func (s *sidecar) doAdminHTTP(ctx context.Context, method, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range s.adminHeaders {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d. Output:\n%s", resp.StatusCode, body)
+	}
+	return string(body), nil
+}
+
+// isUnresolvedAnyError returns true if the error is due to an Any in the response that can't be
+// parsed, either because its type isn't imported or because it has no type (e.g. older versions).
+func isUnresolvedAnyError(err error) bool {
+	return strings.Contains(err.Error(), "could not resolve Any message type") ||
+		strings.Contains(err.Error(), `Any JSON doesn't have '@type'`)
+}
+
+// transientExecErrors are substrings of exec errors caused by the API server or kubelet being
+// briefly unavailable.
+var transientExecErrors = []string{"dial", "connection refused", "EOF", "i/o timeout"}
+
+// isTransientExecError returns true if the exec failed with a transient transport error. A command
+// that ran and exited with an error, such as curl failing on a 404 from the admin endpoint, is
+// never transient, even if its output looks like a connection error.
+func isTransientExecError(err error) bool {
+	if _, ok := cluster.ExitCode(err); ok {
+		return false
+	}
+	for _, e := range transientExecErrors {
+		if strings.Contains(err.Error(), e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sidecar) Raw(path string) (string, error) {
+	return s.adminRequestRaw(context.Background(), strings.TrimPrefix(path, "/"))
+}
+
+// envoyLogLevels are the log levels accepted by the Envoy logging admin endpoint.
+var envoyLogLevels = sets.New("trace", "debug", "info", "warning", "warn", "error", "critical", "off")
+
+func (s *sidecar) SetLogLevel(logger, level string) error {
+	if !envoyLogLevels.Contains(level) {
+		return fmt.Errorf("invalid Envoy log level %q, must be one of %v", level, sets.SortedList(envoyLogLevels))
+	}
+	if logger == "" {
+		logger = "level"
+	}
+	return s.adminPost(fmt.Sprintf("logging?%s=%s", logger, level))
+}
+
+func (s *sidecar) GetLogLevels() (map[string]string, error) {
+	// The logging endpoint only accepts POST. Without parameters, it lists the active loggers.
+	out, err := s.adminExec(context.Background(), "POST", "logging")
+	if err != nil {
+		return nil, err
+	}
+	return parseLogLevels(out), nil
+}
+
+// parseLogLevels parses the active loggers listed by the logging admin endpoint, in the form:
+//
+//	active loggers:
+//	  admin: info
+//	  alternate_protocols_cache: info
+func parseLogLevels(out string) map[string]string {
+	levels := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		name, level, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || strings.TrimSpace(level) == "" {
+			continue
+		}
+		levels[name] = strings.TrimSpace(level)
+	}
+	return levels
+}
+
+func (s *sidecar) Logs() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultLogsTimeout)
+	defer cancel()
+	return s.cluster.PodLogs(ctx, s.podName, s.podNamespace, s.container, false)
+}
+
+func (s *sidecar) LogsOrFail(t test.Failer) string {
+	t.Helper()
+	logs, err := s.Logs()
 	if err != nil {
 		t.Fatal(err)
 	}
 	return logs
 }
+
+func (s *sidecar) LogsWithOptions(opts echo.LogOptions) (string, error) {
+	logOpts := &corev1.PodLogOptions{
+		Container: s.container,
+		TailLines: opts.TailLines,
+		Previous:  opts.Previous,
+	}
+	if opts.SinceTime != nil {
+		since := metav1.NewTime(*opts.SinceTime)
+		logOpts.SinceTime = &since
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultLogsTimeout)
+	defer cancel()
+	res, err := s.cluster.Kube().CoreV1().Pods(s.podNamespace).GetLogs(s.podName, logOpts).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer res.Close()
+	out, err := io.ReadAll(res)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (s *sidecar) Events() ([]corev1.Event, error) {
+	events, err := s.cluster.Kube().CoreV1().Events(s.podNamespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.name", s.podName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing events for pod %s/%s: %v", s.podNamespace, s.podName, err)
+	}
+	return events.Items, nil
+}
+
+func (s *sidecar) EventsOrFail(t test.Failer) []corev1.Event {
+	t.Helper()
+	events, err := s.Events()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// waitForLogTailLines is the number of log lines included in the error of WaitForLog.
+const waitForLogTailLines = 10
+
+func (s *sidecar) WaitForLog(predicate func(line string) bool, options ...retry.Option) error {
+	var lines []string
+	err := waitUntilSuccess(func() error {
+		logs, err := s.Logs()
+		if err != nil {
+			return err
+		}
+		lines = nil
+		if logs != "" {
+			lines = strings.Split(strings.TrimSuffix(logs, "\n"), "\n")
+		}
+		for _, l := range lines {
+			if predicate(l) {
+				return nil
+			}
+		}
+		return fmt.Errorf("no matching log line")
+	}, options...)
+	if err != nil {
+		tail := lines
+		if len(tail) > waitForLogTailLines {
+			tail = tail[len(tail)-waitForLogTailLines:]
+		}
+		return fmt.Errorf("failed waiting for log line, scanned %d lines: %v. Last lines:\n%s",
+			len(lines), err, strings.Join(tail, "\n"))
+	}
+	return nil
+}
+
+func (s *sidecar) WaitForLogOrFail(t test.Failer, predicate func(line string) bool, options ...retry.Option) {
+	t.Helper()
+	if err := s.WaitForLog(predicate, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *sidecar) FollowLogs(ctx context.Context) (<-chan string, error) {
+	res, err := s.cluster.Kube().CoreV1().Pods(s.podNamespace).GetLogs(s.podName, &corev1.PodLogOptions{
+		Container: s.container,
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		defer res.Close()
+		scanner := bufio.NewScanner(res)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines, nil
+}
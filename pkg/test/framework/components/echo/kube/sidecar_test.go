@@ -0,0 +1,231 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilexec "k8s.io/client-go/util/exec"
+
+	istioKube "istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/test/framework/components/cluster"
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+func TestJitter(t *testing.T) {
+	const base = 100 * time.Millisecond
+	cases := []struct {
+		fraction float64
+		min, max time.Duration
+	}{
+		{fraction: 0, min: base, max: base},
+		{fraction: 0.5, min: base / 2, max: base * 3 / 2},
+		{fraction: 1, min: 0, max: base * 2},
+		// Out of range fractions are bounded.
+		{fraction: -1, min: base, max: base},
+		{fraction: 5, min: 0, max: base * 2},
+	}
+	for _, tc := range cases {
+		for i := 0; i < 100; i++ {
+			if got := jitter(base, tc.fraction); got < tc.min || got > tc.max {
+				t.Fatalf("jitter(%v, %v) = %v, want in [%v, %v]", base, tc.fraction, got, tc.min, tc.max)
+			}
+		}
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	const base = 100 * time.Millisecond
+	b := &jitteredBackoff{delay: base, fraction: 0.5, deadline: time.Now().Add(time.Hour)}
+	// The retry package sleeps for the floor of the backoff delay, doubling up to 16x.
+	floor := jitterFloor(base, 0.5)
+	for attempt, d := range []time.Duration{base, 2 * base, 4 * base, 8 * base, 16 * base, 16 * base} {
+		got := floor + b.next()
+		if got < d/2 || got > d*3/2 {
+			t.Fatalf("sleep before retry %d = %v, want in [%v, %v]", attempt+1, got, d/2, d*3/2)
+		}
+		floor = min(floor*2, jitterFloor(base, 0.5)*16)
+	}
+
+	// The extra sleep never runs past the deadline.
+	b = &jitteredBackoff{delay: time.Hour, fraction: 1, deadline: time.Now().Add(-time.Second)}
+	for i := 0; i < 10; i++ {
+		if got := b.next(); got != 0 {
+			t.Fatalf("got extra sleep %v after the deadline, want 0", got)
+		}
+	}
+}
+
+func TestWaitUntilCallerDelay(t *testing.T) {
+	attempts := 0
+	start := time.Now()
+	err := waitUntilSuccess(func() error {
+		attempts++
+		return errors.New("not ready")
+	}, retry.Delay(time.Millisecond), retry.MaxAttempts(5))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if attempts != 5 {
+		t.Fatalf("got %d attempts, want 5", attempts)
+	}
+	// The default delay is 100ms and jittered sleeps could reach seconds; the caller's 1ms delay
+	// must be used as is.
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("4 retries with a 1ms delay took %v", elapsed)
+	}
+}
+
+func TestParseLogLevels(t *testing.T) {
+	out := `active loggers:
+  admin: info
+  http: debug
+  upstream: warning
+`
+	want := map[string]string{"admin": "info", "http": "debug", "upstream": "warning"}
+	if got := parseLogLevels(out); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestAdminCommand(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []SidecarOption
+		want []string
+	}{
+		{
+			name: "pilot-agent",
+			want: []string{"pilot-agent", "request", "GET", "stats"},
+		},
+		{
+			name: "pilot-agent admin port",
+			opts: []SidecarOption{WithAdminPort(15001)},
+			want: []string{"pilot-agent", "request", "GET", "stats", "--debug-port", "15001"},
+		},
+		{
+			name: "curl",
+			opts: []SidecarOption{WithCurl()},
+			want: []string{"curl", "-sS", "--fail-with-body", "-X", "GET", "http://localhost:15000/stats"},
+		},
+		{
+			name: "curl flags and headers",
+			opts: []SidecarOption{
+				WithCurlFlags("--unix-socket", "/etc/envoy/admin.sock"),
+				WithAdminHeaders(map[string]string{"X-B": "b", "Authorization": "Bearer token"}),
+			},
+			want: []string{
+				"curl", "-sS", "--fail-with-body", "-X", "GET", "-H", "Authorization: Bearer token", "-H", "X-B: b",
+				"--unix-socket", "/etc/envoy/admin.sock", "http://localhost:15000/stats",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &sidecar{}
+			for _, o := range tc.opts {
+				o(s)
+			}
+			format, args := s.adminCommand("GET", "stats")
+			got, err := cluster.FormatArgs(format, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckPod(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a-v1", Namespace: "echo"}}
+	c := &cluster.FakeCluster{
+		CLIClient: istioKube.NewFakeClient(pod),
+		Topology:  cluster.Topology{ClusterName: "cls1", ClusterKind: cluster.Fake},
+	}
+
+	if err := newSidecar(*pod, c).checkPod(context.Background()); err != nil {
+		t.Fatalf("unexpected error for existing pod: %v", err)
+	}
+
+	other := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b-v1", Namespace: "echo"}}
+	err := newSidecar(other, c).checkPod(context.Background())
+	if err == nil || err.Error() != "pod echo/b-v1 not found on cluster cls1" {
+		t.Fatalf("got error %v, want pod not found on cluster", err)
+	}
+}
+
+func TestExecOutput(t *testing.T) {
+	cases := []struct {
+		name           string
+		stdout, stderr string
+		want           string
+	}{
+		{name: "empty"},
+		{name: "stdout", stdout: "<html>no healthy upstream</html>", want: "\nStdout:\n<html>no healthy upstream</html>"},
+		{name: "stderr", stderr: "curl: (7) Failed to connect", want: "\nStderr:\ncurl: (7) Failed to connect"},
+		{
+			name:   "both",
+			stdout: "body\n",
+			stderr: "error\n",
+			want:   "\nStdout:\nbody\n\nStderr:\nerror\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := execOutput(tc.stdout, tc.stderr); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsTransientExecError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: errors.New("dial tcp 10.0.0.1:443: connect: connection refused"), want: true},
+		{name: "stream EOF", err: errors.New("error reading from stream: EOF"), want: true},
+		{name: "other", err: errors.New("pods \"foo\" is forbidden"), want: false},
+		{
+			// curl exits 7 when it can't connect, but the exec itself succeeded.
+			name: "command exited",
+			err:  utilexec.CodeExitError{Err: errors.New("command terminated with exit code 7: connection refused"), Code: 7},
+			want: false,
+		},
+		{
+			name: "wrapped command exit",
+			err:  fmt.Errorf("exec: %w", utilexec.CodeExitError{Err: errors.New("EOF"), Code: 22}),
+			want: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isTransientExecError(tc.err); got != tc.want {
+				t.Fatalf("isTransientExecError(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
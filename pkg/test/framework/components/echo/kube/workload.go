@@ -17,6 +17,7 @@ package kube
 import (
 	"context"
 	"fmt"
+	"maps"
 	"sync"
 	"time"
 
@@ -172,6 +173,12 @@ func (w *workload) PodName() string {
 	return n
 }
 
+func (w *workload) Labels() map[string]string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return maps.Clone(w.pod.Labels)
+}
+
 func (w *workload) Address() string {
 	w.mutex.Lock()
 	ip := w.pod.Status.PodIP
@@ -206,6 +213,10 @@ func (w *workload) Sidecar() echo.Sidecar {
 	w.mutex.Lock()
 	s := w.sidecar
 	w.mutex.Unlock()
+	if s == nil {
+		// Avoid returning a non-nil interface holding a nil pointer for workloads without a sidecar.
+		return nil
+	}
 	return s
 }
 
@@ -275,7 +286,7 @@ func (w *workload) connect(pod corev1.Pod) (err error) {
 	}
 
 	if w.hasSidecar {
-		w.sidecar = newSidecar(pod, w.cluster)
+		w.sidecar = newSidecar(pod, w.cluster, sidecarOptions(pod)...)
 	}
 
 	return nil
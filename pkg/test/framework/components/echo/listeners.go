@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"net"
+	"strings"
+)
+
+// ListenerAddress is a listener, as reported by the plaintext Envoy listeners admin endpoint.
+type ListenerAddress struct {
+	// Name of the listener, e.g. "virtualInbound".
+	Name string
+	// Address the listener is bound to, e.g. "0.0.0.0:15006".
+	Address string
+}
+
+// ParseListeners parses the output of the plaintext Envoy listeners admin endpoint (i.e.
+// Sidecar.ListenersText), in output order. Empty lines are ignored.
+func ParseListeners(text string) []ListenerAddress {
+	var out []ListenerAddress
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// Lines are formatted as <name>::<address>. Both may contain "::" with IPv6, so split at the
+		// first separator followed by a valid host:port, falling back to the first separator.
+		name, address, _ := strings.Cut(line, "::")
+		for i := 0; i < len(line); {
+			idx := strings.Index(line[i:], "::")
+			if idx < 0 {
+				break
+			}
+			if _, _, err := net.SplitHostPort(line[i+idx+2:]); err == nil {
+				name, address = line[:i+idx], line[i+idx+2:]
+				break
+			}
+			i += idx + 1
+		}
+		out = append(out, ListenerAddress{Name: name, Address: address})
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseListeners(t *testing.T) {
+	text := `virtualOutbound::0.0.0.0:15001
+virtualInbound::0.0.0.0:15006
+10.96.0.10_53::10.96.0.10:53
+[::]_15006::[::]:15006
+
+0.0.0.0_15090::0.0.0.0:15090
+`
+	want := []ListenerAddress{
+		{Name: "virtualOutbound", Address: "0.0.0.0:15001"},
+		{Name: "virtualInbound", Address: "0.0.0.0:15006"},
+		{Name: "10.96.0.10_53", Address: "10.96.0.10:53"},
+		{Name: "[::]_15006", Address: "[::]:15006"},
+		{Name: "0.0.0.0_15090", Address: "0.0.0.0:15090"},
+	}
+	if diff := cmp.Diff(want, ParseListeners(text)); diff != "" {
+		t.Fatalf("unexpected listeners (-want +got):\n%s", diff)
+	}
+}
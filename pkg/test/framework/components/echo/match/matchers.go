@@ -15,16 +15,26 @@
 package match
 
 import (
+	"fmt"
+	"regexp"
+
 	"istio.io/istio/pkg/test/framework/components/cluster"
 	"istio.io/istio/pkg/test/framework/components/echo"
 	"istio.io/istio/pkg/test/framework/components/namespace"
 )
 
-// Any doesn't filter out any echos.
+// Any doesn't filter out any echos. It is the identity for And, so it can be used as the initial
+// value when folding And over a list of matchers.
 var Any Matcher = func(_ echo.Instance) bool {
 	return true
 }
 
+// None filters out all echos. It is the identity for Or, so it can be used as the initial value
+// when folding Or over a list of matchers.
+var None Matcher = func(_ echo.Instance) bool {
+	return false
+}
+
 // And is an aggregate Matcher that requires all matches return true.
 func And(ms ...Matcher) Matcher {
 	return func(i echo.Instance) bool {
@@ -78,6 +88,18 @@ func AnyServiceName(expected echo.NamespacedNames) Matcher {
 	}
 }
 
+// ServiceNameRegex matches instances whose service name matches the regular expression. The
+// match is unanchored; use ^ and $ to match the whole name. Panics if the pattern is invalid.
+func ServiceNameRegex(pattern string) Matcher {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("match.ServiceNameRegex: invalid pattern %q: %v", pattern, err))
+	}
+	return func(i echo.Instance) bool {
+		return re.MatchString(i.Config().Service)
+	}
+}
+
 // Namespace matches instances within the given namespace name.
 func Namespace(n namespace.Instance) Matcher {
 	return NamespaceName(n.Name())
@@ -97,6 +119,13 @@ func Cluster(c cluster.Cluster) Matcher {
 	}
 }
 
+// ClusterName matches instances deployed on the cluster with the given name.
+func ClusterName(name string) Matcher {
+	return func(i echo.Instance) bool {
+		return i.Config().Cluster.Name() == name
+	}
+}
+
 // Network matches instances deployed in the given network.
 func Network(n string) Matcher {
 	return func(i echo.Instance) bool {
@@ -104,6 +133,43 @@ func Network(n string) Matcher {
 	}
 }
 
+// Label matches instances with any subset that has the given label.
+func Label(key, value string) Matcher {
+	return func(i echo.Instance) bool {
+		for _, s := range i.Config().Subsets {
+			if v, ok := s.Labels[key]; ok && v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Annotation matches instances with any subset whose value for the given annotation, or the
+// annotation's default if the subset doesn't set it, is the given value.
+func Annotation(key echo.Annotation, value string) Matcher {
+	return func(i echo.Instance) bool {
+		for _, s := range i.Config().Subsets {
+			if s.Annotations.Get(key) == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Version matches instances with any subset of the given version.
+func Version(v string) Matcher {
+	return func(i echo.Instance) bool {
+		for _, s := range i.Config().Subsets {
+			if s.Version == v {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // VM matches instances with DeployAsVM
 var VM Matcher = func(i echo.Instance) bool {
 	return i.Config().IsVM()
@@ -15,6 +15,7 @@
 package match_test
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -42,6 +43,11 @@ var (
 	naked1 = &fakeInstance{Cluster: cls1, Namespace: namespace.Static("echo"), Service: "naked", Subsets: []echo.SubsetConfig{{
 		Annotations: echo.NewAnnotations().SetBool(echo.SidecarInject, false),
 	}}}
+	// pod labeled with a team
+	labeled1 = &fakeInstance{Cluster: cls1, Namespace: namespace.Static("echo"), Service: "labeled", Subsets: []echo.SubsetConfig{
+		{Labels: map[string]string{"team": "blue"}},
+		{Labels: map[string]string{"team": "red", "tier": "frontend"}},
+	}}
 	// external svc
 	external1 = &fakeInstance{
 		Cluster: cls1, Namespace: namespace.Static("echo"), Service: "external", DefaultHostHeader: "external.com", Subsets: []echo.SubsetConfig{{
@@ -90,6 +96,197 @@ func TestNaked(t *testing.T) {
 	}
 }
 
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher match.Matcher
+		expect  echo.Instances
+	}{
+		{name: "first subset", matcher: match.Label("team", "blue"), expect: echo.Instances{labeled1}},
+		{name: "second subset", matcher: match.Label("tier", "frontend"), expect: echo.Instances{labeled1}},
+		{name: "value mismatch", matcher: match.Label("team", "green"), expect: nil},
+		{name: "missing key", matcher: match.Label("env", ""), expect: nil},
+		{name: "composed", matcher: match.And(match.Label("team", "red"), match.NotVM), expect: echo.Instances{labeled1}},
+	}
+	all := echo.Instances{a1, b1, vm1, headless1, naked1, external1, labeled1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.matcher.GetMatches(all)
+			if len(got) != len(tt.expect) || (len(got) > 0 && got[0] != tt.expect[0]) {
+				t.Errorf("got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestAnnotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		matcher match.Matcher
+		expect  []string
+	}{
+		{name: "explicit", matcher: match.Annotation(echo.SidecarInject, "false"), expect: []string{"naked", "external"}},
+		{name: "default", matcher: match.Annotation(echo.SidecarInject, "true"), expect: []string{"a", "b"}},
+		{name: "composed", matcher: match.And(match.Annotation(echo.SidecarInject, "false"), match.External), expect: []string{"external"}},
+	}
+	all := echo.Instances{a1, b1, naked1, external1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, i := range tt.matcher.GetMatches(all) {
+				got = append(got, i.Config().Service)
+			}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestClusterName(t *testing.T) {
+	cls2 := &cluster.FakeCluster{Topology: cluster.Topology{ClusterName: "cls2", Network: "n2", Index: 1, ClusterKind: cluster.Fake}}
+	a2 := &fakeInstance{Cluster: cls2, Namespace: namespace.Static("echo"), Service: "a"}
+	all := echo.Instances{a1, b1, a2}
+	tests := []struct {
+		name    string
+		matcher match.Matcher
+		expect  echo.Instances
+	}{
+		{name: "cls1", matcher: match.ClusterName("cls1"), expect: echo.Instances{a1, b1}},
+		{name: "cls2", matcher: match.ClusterName("cls2"), expect: echo.Instances{a2}},
+		{name: "missing", matcher: match.ClusterName("cls3"), expect: echo.Instances{}},
+		{name: "network", matcher: match.Network("n2"), expect: echo.Instances{a2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.matcher.GetMatches(all)
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	versioned := &fakeInstance{Cluster: cls1, Namespace: namespace.Static("echo"), Service: "versioned", Subsets: []echo.SubsetConfig{
+		{Version: "v2"},
+		{Version: "v3"},
+	}}
+	all := echo.Instances{naked1, versioned}
+	tests := []struct {
+		version string
+		expect  []string
+	}{
+		// Subsets default to v1.
+		{version: "v1", expect: []string{"naked"}},
+		{version: "v2", expect: []string{"versioned"}},
+		{version: "v3", expect: []string{"versioned"}},
+		{version: "v4", expect: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			var got []string
+			for _, i := range match.Version(tt.version).GetMatches(all) {
+				got = append(got, i.Config().Service)
+			}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestNot(t *testing.T) {
+	all := echo.Instances{a1, b1, vm1, external1}
+	tests := []struct {
+		name    string
+		matcher match.Matcher
+		expect  []string
+	}{
+		{name: "service", matcher: match.Not(match.ServiceName(external1.NamespacedName())), expect: []string{"a", "b", "vm"}},
+		{name: "and", matcher: match.And(match.Not(match.ServiceName(a1.NamespacedName())), match.NotVM), expect: []string{"b", "external"}},
+		{name: "or", matcher: match.Or(match.Not(match.NamespaceName("echo")), match.VM), expect: []string{"vm"}},
+		{name: "not and", matcher: match.Not(match.And(match.NotVM, match.NotExternal)), expect: []string{"vm", "external"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, i := range tt.matcher.GetMatches(all) {
+				got = append(got, i.Config().Service)
+			}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestAnyNone(t *testing.T) {
+	all := echo.Instances{a1, b1, vm1}
+	fold := func(init match.Matcher, combine func(...match.Matcher) match.Matcher, ms ...match.Matcher) match.Matcher {
+		out := init
+		for _, m := range ms {
+			out = combine(out, m)
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		matcher match.Matcher
+		expect  []string
+	}{
+		{name: "any", matcher: match.Any, expect: []string{"a", "b", "vm"}},
+		{name: "none", matcher: match.None, expect: nil},
+		{name: "empty and", matcher: fold(match.Any, match.And), expect: []string{"a", "b", "vm"}},
+		{name: "empty or", matcher: fold(match.None, match.Or), expect: nil},
+		{name: "and", matcher: fold(match.Any, match.And, match.NotVM, match.Not(match.ServiceName(a1.NamespacedName()))), expect: []string{"b"}},
+		{name: "or", matcher: fold(match.None, match.Or, match.VM, match.ServiceName(a1.NamespacedName())), expect: []string{"a", "vm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, i := range tt.matcher.GetMatches(all) {
+				got = append(got, i.Config().Service)
+			}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestServiceNameRegex(t *testing.T) {
+	external2 := &fakeInstance{Cluster: cls1, Namespace: namespace.Static("echo"), Service: "external-2"}
+	all := echo.Instances{a1, b1, external1, external2}
+	tests := []struct {
+		pattern string
+		expect  []string
+	}{
+		{pattern: "^external-", expect: []string{"external-2"}},
+		{pattern: "^external", expect: []string{"external", "external-2"}},
+		{pattern: "^(a|b)$", expect: []string{"a", "b"}},
+		{pattern: "^c$", expect: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			var got []string
+			for _, i := range match.ServiceNameRegex(tt.pattern).GetMatches(all) {
+				got = append(got, i.Config().Service)
+			}
+			if !reflect.DeepEqual(got, tt.expect) {
+				t.Errorf("got %v expected %v", got, tt.expect)
+			}
+		})
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for invalid pattern")
+		}
+	}()
+	match.ServiceNameRegex("external-(")
+}
+
 var _ echo.Instance = fakeInstance{}
 
 // fakeInstance wraps echo.Config for test-framework internals tests where we don't actually make calls
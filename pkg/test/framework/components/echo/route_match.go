@@ -0,0 +1,420 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+
+	"istio.io/istio/pkg/util/sets"
+)
+
+// MatchRoute simulates Envoy route selection in the config dump for a request with the given host,
+// path and headers. See Sidecar.MatchRoute.
+func MatchRoute(cfg *admin.ConfigDump, host, path string, headers map[string]string) (string, bool, error) {
+	rcs, err := RouteConfigurations(cfg)
+	if err != nil {
+		return "", false, err
+	}
+	return matchRoute(rcs, host, path, headers)
+}
+
+// RoutedHosts returns the domains of all virtual hosts in the route configuration with the given
+// name, in config order. See Sidecar.RoutedHosts.
+func RoutedHosts(cfg *admin.ConfigDump, routeConfigName string) ([]string, error) {
+	rcs, err := RouteConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, rc := range rcs {
+		if rc.GetName() != routeConfigName {
+			continue
+		}
+		out := make([]string, 0)
+		seen := sets.New[string]()
+		for _, vh := range rc.GetVirtualHosts() {
+			for _, d := range vh.GetDomains() {
+				if !seen.InsertContains(d) {
+					out = append(out, d)
+				}
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("route configuration %s not found in Envoy config", routeConfigName)
+}
+
+// RouteMirrorPolicies returns the request mirroring policies of the route with the given name. See
+// Sidecar.RouteMirrorPolicies.
+func RouteMirrorPolicies(cfg *admin.ConfigDump, routeName string) ([]*route.RouteAction_RequestMirrorPolicy, error) {
+	rcs, err := RouteConfigurations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := findRoute(rcs, routeName)
+	if r == nil {
+		return nil, fmt.Errorf("route %s not found in Envoy config", routeName)
+	}
+	return append([]*route.RouteAction_RequestMirrorPolicy{}, r.GetRoute().GetRequestMirrorPolicies()...), nil
+}
+
+// matchRoute simulates Envoy route selection for a request with the given attributes. If the host
+// has a port and there are route configurations for that port (named after the port, as on
+// sidecars, or "<protocol>.<port>", as on gateways), only those are searched, since that is the
+// route configuration of the listener the request would arrive on. Otherwise all route
+// configurations are searched. Among the searched configurations, the virtual host is selected as
+// Envoy does within a single one: exact domains first, then the longest suffix wildcard, then the
+// longest prefix wildcard, then "*"; ties go to the first configuration in name order. Within the
+// virtual host, the first matching route wins. Routes that don't forward to a cluster (e.g.
+// redirects or direct responses) match with an empty cluster name. An error is returned for
+// matchers that depend on more than the request, such as runtime_fraction, and for routes whose
+// cluster is picked at request time, such as cluster_header.
+func matchRoute(rcs []*route.RouteConfiguration, host, path string, headers map[string]string) (string, bool, error) {
+	sorted := routeConfigsForHost(rcs, host)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+
+	hdrs := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		hdrs[strings.ToLower(k)] = v
+	}
+	if _, ok := hdrs[":authority"]; !ok {
+		hdrs[":authority"] = host
+	}
+	if _, ok := hdrs[":path"]; !ok {
+		hdrs[":path"] = path
+	}
+
+	var (
+		vh        *route.VirtualHost
+		bestRank  int
+		bestWidth int
+	)
+	for _, rc := range sorted {
+		candidate, rank, width := virtualHostFor(rc, host)
+		if candidate != nil && (rank > bestRank || (rank == bestRank && width > bestWidth)) {
+			vh, bestRank, bestWidth = candidate, rank, width
+		}
+	}
+	if vh == nil {
+		return "", false, nil
+	}
+	for _, r := range vh.GetRoutes() {
+		matched, err := routeMatches(r.GetMatch(), path, hdrs)
+		if err != nil {
+			return "", false, fmt.Errorf("route %q in virtual host %q: %v", r.GetName(), vh.GetName(), err)
+		}
+		if matched {
+			cluster, err := routeCluster(r)
+			if err != nil {
+				return "", false, fmt.Errorf("route %q in virtual host %q: %v", r.GetName(), vh.GetName(), err)
+			}
+			return cluster, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// routeConfigsForHost returns the route configurations for the port of the host, if it has one
+// and there are any, or else all route configurations.
+func routeConfigsForHost(rcs []*route.RouteConfiguration, host string) []*route.RouteConfiguration {
+	_, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return append([]*route.RouteConfiguration{}, rcs...)
+	}
+	var out []*route.RouteConfiguration
+	for _, rc := range rcs {
+		if rc.GetName() == port || strings.HasSuffix(rc.GetName(), "."+port) {
+			out = append(out, rc)
+		}
+	}
+	if len(out) == 0 {
+		return append([]*route.RouteConfiguration{}, rcs...)
+	}
+	return out
+}
+
+// findRoute returns the first route with the given name. Route configurations are searched in name
+// order, and virtual hosts and routes in config order.
+func findRoute(rcs []*route.RouteConfiguration, name string) *route.Route {
+	sorted := append([]*route.RouteConfiguration{}, rcs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+	for _, rc := range sorted {
+		for _, vh := range rc.GetVirtualHosts() {
+			for _, r := range vh.GetRoutes() {
+				if r.GetName() == name {
+					return r
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Ranks of the virtual host domain matches, in Envoy's order of preference.
+const (
+	domainMatchAny = iota + 1
+	domainMatchPrefixWildcard
+	domainMatchSuffixWildcard
+	domainMatchExact
+)
+
+// virtualHostFor returns the virtual host that Envoy would select for the host, preferring exact
+// domains, then the longest suffix wildcard, then the longest prefix wildcard, then "*". The rank
+// and length of the matched domain are returned so that matches can be compared across route
+// configurations.
+func virtualHostFor(rc *route.RouteConfiguration, host string) (vh *route.VirtualHost, rank, width int) {
+	host = strings.ToLower(host)
+	for _, candidate := range rc.GetVirtualHosts() {
+		for _, domain := range candidate.GetDomains() {
+			domain = strings.ToLower(domain)
+			var r int
+			switch {
+			case domain == host:
+				return candidate, domainMatchExact, len(domain)
+			case domain == "*":
+				r = domainMatchAny
+			case strings.HasPrefix(domain, "*") && strings.HasSuffix(host, domain[1:]) && len(host) > len(domain)-1:
+				r = domainMatchSuffixWildcard
+			case strings.HasSuffix(domain, "*") && strings.HasPrefix(host, domain[:len(domain)-1]) && len(host) > len(domain)-1:
+				r = domainMatchPrefixWildcard
+			default:
+				continue
+			}
+			if r > rank || (r == rank && len(domain) > width) {
+				vh, rank, width = candidate, r, len(domain)
+			}
+		}
+	}
+	return vh, rank, width
+}
+
+func routeMatches(m *route.RouteMatch, path string, headers map[string]string) (bool, error) {
+	switch {
+	case m.GetRuntimeFraction() != nil:
+		return false, fmt.Errorf("unsupported matcher runtime_fraction")
+	case m.GetTlsContext() != nil:
+		return false, fmt.Errorf("unsupported matcher tls_context")
+	case len(m.GetDynamicMetadata()) > 0:
+		return false, fmt.Errorf("unsupported matcher dynamic_metadata")
+	case len(m.GetFilterState()) > 0:
+		return false, fmt.Errorf("unsupported matcher filter_state")
+	}
+
+	if i := strings.IndexByte(path, '#'); i >= 0 {
+		path = path[:i]
+	}
+	var query string
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+	caseSensitive := m.GetCaseSensitive() == nil || m.GetCaseSensitive().GetValue()
+	fold := func(s string) string {
+		if caseSensitive {
+			return s
+		}
+		return strings.ToLower(s)
+	}
+
+	var matched bool
+	switch ps := m.GetPathSpecifier().(type) {
+	case *route.RouteMatch_Prefix:
+		matched = strings.HasPrefix(fold(path), fold(ps.Prefix))
+	case *route.RouteMatch_Path:
+		matched = fold(path) == fold(ps.Path)
+	case *route.RouteMatch_SafeRegex:
+		re, err := compileFullMatch(ps.SafeRegex.GetRegex())
+		if err != nil {
+			return false, err
+		}
+		matched = re.MatchString(path)
+	case *route.RouteMatch_PathSeparatedPrefix:
+		prefix := fold(ps.PathSeparatedPrefix)
+		matched = fold(path) == prefix || strings.HasPrefix(fold(path), prefix+"/")
+	default:
+		return false, fmt.Errorf("unsupported path matcher %T", ps)
+	}
+	if !matched {
+		return false, nil
+	}
+
+	// Envoy matches gRPC requests on the content type.
+	if m.GetGrpc() != nil && !strings.HasPrefix(headers["content-type"], "application/grpc") {
+		return false, nil
+	}
+	for _, hm := range m.GetHeaders() {
+		ok, err := headerMatches(hm, headers)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if len(m.GetQueryParameters()) > 0 {
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			return false, fmt.Errorf("invalid query %q: %v", query, err)
+		}
+		for _, qm := range m.GetQueryParameters() {
+			ok, err := queryParameterMatches(qm, params)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// queryParameterMatches returns whether the query parameter matches. As in Envoy, the first value
+// of the parameter is matched, and a matcher without a value only requires the parameter.
+func queryParameterMatches(qm *route.QueryParameterMatcher, params url.Values) (bool, error) {
+	values, present := params[qm.GetName()]
+	switch spec := qm.GetQueryParameterMatchSpecifier().(type) {
+	case nil:
+		return present, nil
+	case *route.QueryParameterMatcher_PresentMatch:
+		return present == spec.PresentMatch, nil
+	case *route.QueryParameterMatcher_StringMatch:
+		if !present {
+			return false, nil
+		}
+		return stringMatches(spec.StringMatch, values[0])
+	default:
+		return false, fmt.Errorf("unsupported query parameter matcher %T for parameter %q", spec, qm.GetName())
+	}
+}
+
+func headerMatches(hm *route.HeaderMatcher, headers map[string]string) (bool, error) {
+	value, present := headers[strings.ToLower(hm.GetName())]
+	if !present && hm.GetTreatMissingHeaderAsEmpty() {
+		present = true
+	}
+
+	var (
+		matched bool
+		err     error
+	)
+	switch spec := hm.GetHeaderMatchSpecifier().(type) {
+	case nil:
+		matched = present
+	case *route.HeaderMatcher_PresentMatch:
+		matched = present == spec.PresentMatch
+	case *route.HeaderMatcher_ExactMatch:
+		matched = present && value == spec.ExactMatch
+	case *route.HeaderMatcher_PrefixMatch:
+		matched = present && strings.HasPrefix(value, spec.PrefixMatch)
+	case *route.HeaderMatcher_SuffixMatch:
+		matched = present && strings.HasSuffix(value, spec.SuffixMatch)
+	case *route.HeaderMatcher_ContainsMatch:
+		matched = present && strings.Contains(value, spec.ContainsMatch)
+	case *route.HeaderMatcher_SafeRegexMatch:
+		var re *regexp.Regexp
+		if re, err = compileFullMatch(spec.SafeRegexMatch.GetRegex()); err == nil {
+			matched = present && re.MatchString(value)
+		}
+	case *route.HeaderMatcher_RangeMatch:
+		if present {
+			n, perr := strconv.ParseInt(value, 10, 64)
+			matched = perr == nil && n >= spec.RangeMatch.GetStart() && n < spec.RangeMatch.GetEnd()
+		}
+	case *route.HeaderMatcher_StringMatch:
+		if present {
+			matched, err = stringMatches(spec.StringMatch, value)
+		}
+	default:
+		err = fmt.Errorf("unsupported header matcher %T for header %q", spec, hm.GetName())
+	}
+	if err != nil {
+		return false, err
+	}
+	if hm.GetInvertMatch() {
+		matched = !matched
+	}
+	return matched, nil
+}
+
+func stringMatches(m *matcher.StringMatcher, value string) (bool, error) {
+	fold := func(s string) string {
+		if m.GetIgnoreCase() {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	switch p := m.GetMatchPattern().(type) {
+	case *matcher.StringMatcher_Exact:
+		return fold(value) == fold(p.Exact), nil
+	case *matcher.StringMatcher_Prefix:
+		return strings.HasPrefix(fold(value), fold(p.Prefix)), nil
+	case *matcher.StringMatcher_Suffix:
+		return strings.HasSuffix(fold(value), fold(p.Suffix)), nil
+	case *matcher.StringMatcher_Contains:
+		return strings.Contains(fold(value), fold(p.Contains)), nil
+	case *matcher.StringMatcher_SafeRegex:
+		re, err := compileFullMatch(p.SafeRegex.GetRegex())
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(value), nil
+	default:
+		return false, fmt.Errorf("unsupported string matcher %T", p)
+	}
+}
+
+// compileFullMatch compiles an RE2 regex that, like Envoy's safe_regex, must match the entire input.
+func compileFullMatch(expr string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %v", expr, err)
+	}
+	return re, nil
+}
+
+// routeCluster returns the cluster a route forwards to. For weighted clusters, the cluster with the
+// highest weight is returned. An error is returned if the cluster is only known at request time.
+func routeCluster(r *route.Route) (string, error) {
+	action := r.GetRoute()
+	if action == nil {
+		return "", nil
+	}
+	switch cs := action.GetClusterSpecifier().(type) {
+	case *route.RouteAction_Cluster:
+		return cs.Cluster, nil
+	case *route.RouteAction_WeightedClusters:
+		var (
+			name   string
+			weight uint32
+		)
+		for _, c := range cs.WeightedClusters.GetClusters() {
+			if name == "" || c.GetWeight().GetValue() > weight {
+				name, weight = c.GetName(), c.GetWeight().GetValue()
+			}
+		}
+		return name, nil
+	case *route.RouteAction_ClusterHeader:
+		return "", fmt.Errorf("cluster is taken from the request header %q", cs.ClusterHeader)
+	default:
+		return "", fmt.Errorf("unsupported cluster specifier %T", cs)
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"strings"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMatchRoute(t *testing.T) {
+	forward := func(cluster string) *route.Route_Route {
+		return &route.Route_Route{Route: &route.RouteAction{
+			ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster},
+		}}
+	}
+	rcs := []*route.RouteConfiguration{
+		{
+			Name: "80",
+			VirtualHosts: []*route.VirtualHost{
+				{
+					Name:    "foo",
+					Domains: []string{"foo.ns.svc.cluster.local", "foo.ns.svc.cluster.local:80"},
+					Routes: []*route.Route{
+						{
+							Match: &route.RouteMatch{
+								PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+								Headers: []*route.HeaderMatcher{{
+									Name: "x-canary",
+									HeaderMatchSpecifier: &route.HeaderMatcher_StringMatch{StringMatch: &matcher.StringMatcher{
+										MatchPattern: &matcher.StringMatcher_Exact{Exact: "true"},
+									}},
+								}},
+							},
+							Action: forward("outbound|80|v2|foo.ns.svc.cluster.local"),
+						},
+						{
+							Match: &route.RouteMatch{
+								PathSpecifier: &route.RouteMatch_SafeRegex{SafeRegex: &matcher.RegexMatcher{Regex: "/api/v[0-9]+"}},
+							},
+							Action: forward("outbound|80|api|foo.ns.svc.cluster.local"),
+						},
+						{
+							Match: &route.RouteMatch{
+								PathSpecifier: &route.RouteMatch_Path{Path: "/exact"},
+							},
+							Action: &route.Route_Route{Route: &route.RouteAction{
+								ClusterSpecifier: &route.RouteAction_WeightedClusters{WeightedClusters: &route.WeightedCluster{
+									Clusters: []*route.WeightedCluster_ClusterWeight{
+										{Name: "light", Weight: wrapperspb.UInt32(10)},
+										{Name: "heavy", Weight: wrapperspb.UInt32(90)},
+									},
+								}},
+							}},
+						},
+						{
+							Match: &route.RouteMatch{
+								PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/v1"},
+							},
+							Action: forward("outbound|80|v1|foo.ns.svc.cluster.local"),
+						},
+					},
+				},
+				{
+					Name:    "wildcard",
+					Domains: []string{"*.example.com"},
+					Routes: []*route.Route{{
+						Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+						Action: forward("outbound|80||wildcard.example.com"),
+					}},
+				},
+				{
+					Name:    "allow_any",
+					Domains: []string{"*"},
+					Routes: []*route.Route{{
+						Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+						Action: forward("PassthroughCluster"),
+					}},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name        string
+		host        string
+		path        string
+		headers     map[string]string
+		wantCluster string
+		wantFound   bool
+	}{
+		{
+			name:        "header match",
+			host:        "foo.ns.svc.cluster.local",
+			path:        "/v1/hello",
+			headers:     map[string]string{"X-Canary": "true"},
+			wantCluster: "outbound|80|v2|foo.ns.svc.cluster.local",
+			wantFound:   true,
+		},
+		{
+			name:        "regex match",
+			host:        "foo.ns.svc.cluster.local:80",
+			path:        "/api/v2?query=1",
+			wantCluster: "outbound|80|api|foo.ns.svc.cluster.local",
+			wantFound:   true,
+		},
+		{
+			name:        "exact match with weighted clusters",
+			host:        "foo.ns.svc.cluster.local",
+			path:        "/exact",
+			wantCluster: "heavy",
+			wantFound:   true,
+		},
+		{
+			name:        "prefix match",
+			host:        "foo.ns.svc.cluster.local",
+			path:        "/v1/hello",
+			wantCluster: "outbound|80|v1|foo.ns.svc.cluster.local",
+			wantFound:   true,
+		},
+		{
+			name:      "no route in virtual host",
+			host:      "foo.ns.svc.cluster.local",
+			path:      "/other",
+			wantFound: false,
+		},
+		{
+			name:        "wildcard domain",
+			host:        "bar.example.com",
+			path:        "/",
+			wantCluster: "outbound|80||wildcard.example.com",
+			wantFound:   true,
+		},
+		{
+			name:        "catch all domain",
+			host:        "unknown.com",
+			path:        "/",
+			wantCluster: "PassthroughCluster",
+			wantFound:   true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster, found, err := matchRoute(rcs, tc.host, tc.path, tc.headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tc.wantFound || cluster != tc.wantCluster {
+				t.Fatalf("got (%q, %v), want (%q, %v)", cluster, found, tc.wantCluster, tc.wantFound)
+			}
+		})
+	}
+}
+
+func TestMatchRouteQueryAndGRPC(t *testing.T) {
+	forward := func(cluster string) *route.Route_Route {
+		return &route.Route_Route{Route: &route.RouteAction{
+			ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster},
+		}}
+	}
+	rcs := []*route.RouteConfiguration{{
+		Name: "80",
+		VirtualHosts: []*route.VirtualHost{{
+			Name:    "foo",
+			Domains: []string{"foo"},
+			Routes: []*route.Route{
+				{
+					Match: &route.RouteMatch{
+						PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+						QueryParameters: []*route.QueryParameterMatcher{{
+							Name: "version",
+							QueryParameterMatchSpecifier: &route.QueryParameterMatcher_StringMatch{StringMatch: &matcher.StringMatcher{
+								MatchPattern: &matcher.StringMatcher_Exact{Exact: "v2"},
+							}},
+						}},
+					},
+					Action: forward("v2"),
+				},
+				{
+					Match: &route.RouteMatch{
+						PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+						QueryParameters: []*route.QueryParameterMatcher{{
+							Name:                         "debug",
+							QueryParameterMatchSpecifier: &route.QueryParameterMatcher_PresentMatch{PresentMatch: true},
+						}},
+					},
+					Action: forward("debug"),
+				},
+				{
+					Match: &route.RouteMatch{
+						PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+						Grpc:          &route.RouteMatch_GrpcRouteMatchOptions{},
+					},
+					Action: forward("grpc"),
+				},
+				{
+					Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+					Action: forward("default"),
+				},
+			},
+		}},
+	}}
+
+	cases := []struct {
+		name        string
+		path        string
+		headers     map[string]string
+		wantCluster string
+	}{
+		{name: "query parameter value", path: "/hello?version=v2", wantCluster: "v2"},
+		{name: "first value of the query parameter", path: "/hello?version=v1&version=v2", wantCluster: "default"},
+		{name: "escaped query parameter", path: "/hello?debug&version=%76%32", wantCluster: "v2"},
+		{name: "query parameter present", path: "/hello?debug", wantCluster: "debug"},
+		{name: "no query", path: "/hello", wantCluster: "default"},
+		{name: "grpc", path: "/svc/Method", headers: map[string]string{"Content-Type": "application/grpc+proto"}, wantCluster: "grpc"},
+		{name: "not grpc", path: "/svc/Method", headers: map[string]string{"Content-Type": "application/json"}, wantCluster: "default"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster, found, err := matchRoute(rcs, "foo", tc.path, tc.headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found || cluster != tc.wantCluster {
+				t.Fatalf("got (%q, %v), want (%q, true)", cluster, found, tc.wantCluster)
+			}
+		})
+	}
+}
+
+func TestMatchRouteUnsupported(t *testing.T) {
+	cases := []struct {
+		name    string
+		route   *route.Route
+		wantErr string
+	}{
+		{
+			name: "runtime fraction",
+			route: &route.Route{
+				Match: &route.RouteMatch{
+					PathSpecifier:   &route.RouteMatch_Prefix{Prefix: "/"},
+					RuntimeFraction: &core.RuntimeFractionalPercent{DefaultValue: &typev3.FractionalPercent{Numerator: 50}},
+				},
+				Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "a"}}},
+			},
+			wantErr: "unsupported matcher runtime_fraction",
+		},
+		{
+			name: "cluster header",
+			route: &route.Route{
+				Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+				Action: &route.Route_Route{Route: &route.RouteAction{
+					ClusterSpecifier: &route.RouteAction_ClusterHeader{ClusterHeader: "x-cluster"},
+				}},
+			},
+			wantErr: `cluster is taken from the request header "x-cluster"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rcs := []*route.RouteConfiguration{{
+				Name:         "80",
+				VirtualHosts: []*route.VirtualHost{{Name: "foo", Domains: []string{"*"}, Routes: []*route.Route{tc.route}}},
+			}}
+			_, found, err := matchRoute(rcs, "foo", "/", nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) || found {
+				t.Fatalf("got (found=%v, err=%v), want error %q", found, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchRouteAcrossRouteConfigs(t *testing.T) {
+	// Every sidecar route configuration has a catch-all virtual host, so the route configuration
+	// must be chosen by port or by the best domain match, not by whichever sorts first.
+	routeConfig := func(name, domain, cluster, catchAll string) *route.RouteConfiguration {
+		forwardAll := func(cluster string) []*route.Route {
+			return []*route.Route{{
+				Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+				Action: &route.Route_Route{Route: &route.RouteAction{
+					ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster},
+				}},
+			}}
+		}
+		return &route.RouteConfiguration{
+			Name: name,
+			VirtualHosts: []*route.VirtualHost{
+				{Name: domain, Domains: []string{domain, domain + ":" + name}, Routes: forwardAll(cluster)},
+				{Name: "allow_any", Domains: []string{"*"}, Routes: forwardAll(catchAll)},
+			},
+		}
+	}
+	rcs := []*route.RouteConfiguration{
+		routeConfig("80", "foo.ns.svc.cluster.local", "outbound|80||foo.ns.svc.cluster.local", "PassthroughCluster"),
+		routeConfig("15010", "istiod.istio-system.svc", "outbound|15010||istiod.istio-system.svc", "PassthroughCluster"),
+		routeConfig("9080", "reviews.ns.svc.cluster.local", "outbound|9080||reviews.ns.svc.cluster.local", "BlackHoleCluster"),
+	}
+
+	cases := []struct {
+		name        string
+		host        string
+		wantCluster string
+	}{
+		{
+			name:        "port selects route config",
+			host:        "foo.ns.svc.cluster.local:80",
+			wantCluster: "outbound|80||foo.ns.svc.cluster.local",
+		},
+		{
+			name:        "exact domain preferred over catch all in other route configs",
+			host:        "foo.ns.svc.cluster.local",
+			wantCluster: "outbound|80||foo.ns.svc.cluster.local",
+		},
+		{
+			name:        "catch all of the port's route config",
+			host:        "unknown.com:9080",
+			wantCluster: "BlackHoleCluster",
+		},
+		{
+			name:        "host only routed on another port",
+			host:        "reviews.ns.svc.cluster.local:80",
+			wantCluster: "PassthroughCluster",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster, found, err := matchRoute(rcs, tc.host, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !found || cluster != tc.wantCluster {
+				t.Fatalf("got (%q, %v), want (%q, true)", cluster, found, tc.wantCluster)
+			}
+		})
+	}
+}
+
+func TestFindRoute(t *testing.T) {
+	rcs := []*route.RouteConfiguration{
+		{
+			Name: "9080",
+			VirtualHosts: []*route.VirtualHost{{
+				Name:   "reviews",
+				Routes: []*route.Route{{Name: "mirrored"}},
+			}},
+		},
+		{
+			Name: "80",
+			VirtualHosts: []*route.VirtualHost{
+				{Name: "foo", Routes: []*route.Route{{Name: "default"}}},
+				{Name: "bar", Routes: []*route.Route{{Name: "allow_any"}, {Name: "mirrored"}}},
+			},
+		},
+	}
+	for _, name := range []string{"default", "allow_any"} {
+		if r := findRoute(rcs, name); r.GetName() != name {
+			t.Fatalf("findRoute(%q) = %v", name, r)
+		}
+	}
+	// Route configs are searched in name order.
+	if r := findRoute(rcs, "mirrored"); r != rcs[1].VirtualHosts[1].Routes[1] {
+		t.Fatalf("findRoute(mirrored) returned route from wrong route config")
+	}
+	if r := findRoute(rcs, "missing"); r != nil {
+		t.Fatalf("findRoute(missing) = %v, want nil", r)
+	}
+}
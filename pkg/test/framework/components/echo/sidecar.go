@@ -15,38 +15,317 @@
 package echo
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	admin "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	envoycluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	upstreamhttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
 
 	"istio.io/istio/pkg/test"
+	"istio.io/istio/pkg/test/framework/components/cluster"
 	"istio.io/istio/pkg/test/util/retry"
 )
 
-// Sidecar provides an interface to execute queries against a single Envoy sidecar.
+// ErrUnresolvedAnyType is returned by Sidecar queries when the Envoy admin response contains an Any
+// that can't be parsed, typically because the XDS types it references aren't imported.
+var ErrUnresolvedAnyType = errors.New("unresolved Any message type")
+
+// Runtime is the response of the Envoy runtime admin endpoint.
+type Runtime struct {
+	// Layers are the names of the runtime layers, from lowest to highest priority.
+	Layers []string `json:"layers"`
+	// Entries are the runtime values, keyed by runtime key.
+	Entries map[string]RuntimeEntry `json:"entries"`
+}
+
+// RuntimeEntry is the value of a runtime key.
+type RuntimeEntry struct {
+	// LayerValues are the values of the key in each layer, in the same order as Runtime.Layers.
+	// Layers that don't set the key have an empty value.
+	LayerValues []string `json:"layer_values"`
+	// FinalValue is the effective value of the key.
+	FinalValue string `json:"final_value"`
+}
+
+// LogOptions filters the logs returned by Sidecar.LogsWithOptions.
+type LogOptions struct {
+	// TailLines, if set, limits the logs to this number of lines from the end.
+	TailLines *int64
+	// SinceTime, if set, limits the logs to those written at or after this time.
+	SinceTime *time.Time
+	// Previous returns the logs of the previous instance of the container, e.g. before it crashed.
+	Previous bool
+}
+
+// DrainOptions configures Sidecar.Drain.
+type DrainOptions struct {
+	// Graceful, if true, drains the listeners gracefully over the proxy's drain period, rather than
+	// closing them immediately.
+	Graceful bool
+}
+
+// Sidecar provides an interface to execute queries against a single Envoy sidecar. The Context
+// variants of the admin queries abort the query when the context is cancelled.
 type Sidecar interface {
+	// PodName is the name of the pod running the proxy.
+	PodName() string
+	// PodNamespace is the namespace of the pod running the proxy.
+	PodNamespace() string
+	// Cluster is the cluster of the pod running the proxy.
+	Cluster() cluster.Cluster
+
 	// Info about the Envoy instance.
 	Info() (*admin.ServerInfo, error)
+	InfoContext(ctx context.Context) (*admin.ServerInfo, error)
 	InfoOrFail(t test.Failer) *admin.ServerInfo
 
+	// Ready returns true if the Envoy server state is LIVE.
+	Ready() (bool, error)
+
+	// WaitUntilReady polls the Envoy server state until it is LIVE, or the retry times out.
+	WaitUntilReady(options ...retry.Option) error
+
+	// Drain drains the listeners of the Envoy instance. New connections are refused while
+	// existing connections are allowed to complete.
+	Drain(opts DrainOptions) error
+
+	// WaitForDraining polls the Envoy server state until it is DRAINING, or the retry times out.
+	WaitForDraining(options ...retry.Option) error
+
+	// Quit cleanly shuts down the Envoy instance. The proxy container will likely be restarted,
+	// or the pod terminated, depending on the pod's restart policy and whether the proxy runs as a
+	// native sidecar; the Sidecar can't be queried until the proxy is back.
+	Quit() error
+
+	// Memory usage of the Envoy instance.
+	Memory() (*admin.Memory, error)
+	MemoryOrFail(t test.Failer) *admin.Memory
+
+	// Runtime layers and values of the Envoy instance.
+	Runtime() (*Runtime, error)
+	RuntimeOrFail(t test.Failer) *Runtime
+
+	// HotRestartVersion of the Envoy instance. Two Envoy binaries can only hot restart into each
+	// other if their hot restart versions are equal.
+	HotRestartVersion() (string, error)
+	HotRestartVersionOrFail(t test.Failer) string
+
 	// Config of the Envoy instance.
 	Config() (*admin.ConfigDump, error)
+	ConfigContext(ctx context.Context) (*admin.ConfigDump, error)
 	ConfigOrFail(t test.Failer) *admin.ConfigDump
 
+	// ConfigForType returns the config dump filtered to a single resource type, such as
+	// dynamic_listeners or dynamic_active_clusters. This is much smaller than the full config dump.
+	ConfigForType(resourceType string) (*admin.ConfigDump, error)
+
+	// Bootstrap config of the Envoy instance.
+	Bootstrap() (*admin.BootstrapConfigDump, error)
+	BootstrapOrFail(t test.Failer) *admin.BootstrapConfigDump
+
+	// DumpDebug writes the normalized config dump (see NormalizeConfigDump), clusters, listeners,
+	// server info, stats and logs of the Envoy instance to files in the given directory. A failure to get one of these does not
+	// prevent the others from being written; all failures are returned.
+	DumpDebug(dir string) error
+
+	// ConfigDiff returns a unified diff of two config dumps of the Envoy instance, such as before and
+	// after applying config. The per-resource last_updated and version_info fields are ignored.
+	// Returns an empty string if the config dumps are equivalent.
+	ConfigDiff(before, after *admin.ConfigDump) (string, error)
+
 	// WaitForConfig queries the Envoy configuration an executes the given accept handler. If the
 	// response is not accepted, the request will be retried until either a timeout or a response
-	// has been accepted.
+	// has been accepted. If the config dump can't be parsed due to an unresolved Any type, an error
+	// wrapping ErrUnresolvedAnyType is returned immediately. To guard against config that flaps
+	// during propagation, pass retry.Converge(n) to require n consecutive acceptances; a rejection
+	// resets the count. Passing retry.MaxAttempts(n) bounds the number of queries as well: waiting
+	// stops at the timeout or after n attempts, whichever comes first.
 	WaitForConfig(accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) error
 	WaitForConfigOrFail(t test.Failer, accept func(*admin.ConfigDump) (bool, error), options ...retry.Option)
 
+	// WaitForConfigWithEndpoints is like WaitForConfig, but the config dump passed to the accept
+	// handler includes the EDS endpoints of the clusters, which the plain config dump omits. The
+	// config dump is much larger, so only use this for handlers that inspect endpoints.
+	WaitForConfigWithEndpoints(accept func(*admin.ConfigDump) (bool, error), options ...retry.Option) error
+
+	// WaitForConfigAll is like WaitForConfig, but the config is only accepted if all the accept
+	// handlers accept the same config dump.
+	WaitForConfigAll(accepts []func(*admin.ConfigDump) (bool, error), options ...retry.Option) error
+	WaitForConfigAllOrFail(t test.Failer, accepts []func(*admin.ConfigDump) (bool, error), options ...retry.Option)
+
+	// ConfigVersion returns the xDS version_info of each dynamic resource type in the config dump,
+	// including endpoints. See ConfigVersions for the keys of the returned map.
+	ConfigVersion() (map[string]string, error)
+
+	// WaitForConfigVersionChange waits until the config version differs from the previous one
+	// returned by ConfigVersion, i.e. until an xDS push has been applied by the Envoy instance.
+	WaitForConfigVersionChange(previous map[string]string, options ...retry.Option) error
+
+	// ConfigForHost returns the listeners, routes, clusters and endpoints that apply to requests for
+	// the given host, which may include a port (e.g. "foo.ns.svc.cluster.local:80"). Virtual hosts
+	// are matched by exact domain. Returns an error if no config references the host.
+	ConfigForHost(host string) (*HostConfig, error)
+
 	// Clusters for the Envoy instance
 	Clusters() (*admin.Clusters, error)
+	ClustersContext(ctx context.Context) (*admin.Clusters, error)
 	ClustersOrFail(t test.Failer) *admin.Clusters
+	// GetEndpoints returns the endpoints of the named cluster, with their health and weight.
+	GetEndpoints(cluster string) ([]ClusterEndpoint, error)
+
+	// WaitForHealthyEndpoints waits until at least min endpoints of the named cluster are healthy
+	// (see ClusterEndpoint.Healthy). On timeout, the error includes the health of each endpoint.
+	WaitForHealthyEndpoints(cluster string, min int, options ...retry.Option) error
+	// ClustersText returns the plaintext output of the clusters admin endpoint, which includes
+	// endpoint health flags. See ParseClusterEndpoints.
+	ClustersText() (string, error)
+	// ListenersText returns the plaintext output of the listeners admin endpoint, which lists the
+	// name and address of each listener. See ParseListeners.
+	ListenersText() (string, error)
 
 	// Listeners for the Envoy instance
 	Listeners() (*admin.Listeners, error)
+	ListenersContext(ctx context.Context) (*admin.Listeners, error)
 	ListenersOrFail(t test.Failer) *admin.Listeners
 
+	// WaitForListeners queries the Envoy listeners and executes the given accept handler. If the
+	// response is not accepted, the request will be retried until either a timeout or a response
+	// has been accepted.
+	WaitForListeners(accept func(*admin.Listeners) (bool, error), options ...retry.Option) error
+	WaitForListenersOrFail(t test.Failer, accept func(*admin.Listeners) (bool, error), options ...retry.Option)
+
+	// Certs returns the certificates loaded by the Envoy instance
+	Certs() (*admin.Certificates, error)
+	CertsContext(ctx context.Context) (*admin.Certificates, error)
+	CertsOrFail(t test.Failer) *admin.Certificates
+
+	// Secrets returns the static, active and warming secrets of the Envoy instance, including those
+	// delivered by SDS, from the config dump. Returns an empty dump if the instance has no secrets.
+	Secrets() (*admin.SecretsConfigDump, error)
+	SecretsOrFail(t test.Failer) *admin.SecretsConfigDump
+
+	// HTTPConnectionPool returns the HTTP protocol options (e.g. max requests per connection, HTTP/2
+	// max concurrent streams) of the cluster for the given FQDN or cluster name. Returns nil if the
+	// cluster has no HTTP protocol options. As for the other cluster queries below, an FQDN is
+	// resolved to the service's cluster without a subset, and is an error if the service has
+	// clusters for several ports (see FindCluster).
+	HTTPConnectionPool(fqdn string) (*upstreamhttp.HttpProtocolOptions, error)
+
+	// HealthChecks returns the active health checks configured on the cluster for the given FQDN or
+	// cluster name. Returns an empty slice if no active health checks are configured.
+	HealthChecks(fqdn string) ([]*core.HealthCheck, error)
+
+	// LoadBalancerPolicy returns the load balancing policy (e.g. ROUND_ROBIN, LEAST_REQUEST, RING_HASH)
+	// of the cluster for the given FQDN or cluster name.
+	LoadBalancerPolicy(fqdn string) (envoycluster.Cluster_LbPolicy, error)
+
+	// LoadBalancerHash returns the consistent hash config of the cluster for the given FQDN or
+	// cluster name: its RING_HASH or MAGLEV config, if any, and the hash policies of the routes that
+	// forward to it, which is where Istio sets the hashed request attributes.
+	LoadBalancerHash(fqdn string) (*LoadBalancerHash, error)
+
+	// UpstreamTLSSANs returns the subject alternative names verified by the upstream TLS context of
+	// the cluster for the given FQDN or cluster name. Returns an error if the cluster has no TLS context.
+	UpstreamTLSSANs(fqdn string) ([]string, error)
+
+	// IsMutualTLS returns true if the cluster for the given FQDN or cluster name originates mutual
+	// TLS, i.e. presents a client certificate, either directly or through an SDS secret. Transport
+	// socket matches, as used by Istio auto mTLS, are included. TLS origination without a client
+	// certificate is not mutual TLS.
+	IsMutualTLS(fqdn string) (bool, error)
+
+	// ListenerFilters returns the names of the listener filters (e.g. envoy.filters.listener.tls_inspector)
+	// configured on the listeners bound to the given port.
+	ListenerFilters(port uint32) ([]string, error)
+
+	// ListenerSummary returns the number of active listeners of each type. Virtual listeners are the
+	// virtualInbound and virtualOutbound listeners used to capture redirected traffic; all other
+	// listeners are counted as either inbound or outbound based on their traffic direction.
+	ListenerSummary() (inbound, outbound, virtual int, err error)
+
+	// FilterPresentInContext returns true if a listener, network or HTTP filter with the given name is
+	// present on any of the listeners that an EnvoyFilter patch with the given context (ANY,
+	// SIDECAR_INBOUND, SIDECAR_OUTBOUND or GATEWAY) applies to. The proxy type is taken from the
+	// bootstrap node ID: GATEWAY never matches on a sidecar, nor the SIDECAR contexts on a gateway.
+	FilterPresentInContext(context string, filterName string) (bool, error)
+
+	// CompressionConfig returns the config of the first compressor HTTP filter on the listeners bound
+	// to the given port, as an *envoy.extensions.filters.http.compressor.v3.Compressor. The compression
+	// library (e.g. gzip or brotli) is in its compressor_library. Returns false if no compressor
+	// filter is configured on the port.
+	CompressionConfig(port uint32) (proto.Message, bool, error)
+
+	// Stats returns the Envoy counters and gauges, keyed by stat name. Histograms are not included.
+	Stats() (map[string]uint64, error)
+	StatsContext(ctx context.Context) (map[string]uint64, error)
+	StatsOrFail(t test.Failer) map[string]uint64
+
+	// PrometheusStats returns the Envoy stats in Prometheus format, keyed by metric family name.
+	// Unlike Stats, this includes histograms and preserves the labels of tagged stats.
+	PrometheusStats() (map[string]*dto.MetricFamily, error)
+
+	// ResetStats resets all Envoy counters to zero.
+	ResetStats() error
+
+	// WaitForStat polls the Envoy stats until the value of the named counter or gauge is accepted by
+	// the predicate, or the retry times out.
+	WaitForStat(name string, predicate func(uint64) bool, options ...retry.Option) error
+
+	// WaitForStatAtLeast polls the Envoy stats until the named counter or gauge reaches at least the
+	// given value, or the retry times out.
+	WaitForStatAtLeast(name string, min float64, options ...retry.Option) error
+
+	// Locality returns the region, zone and subzone of the proxy, as reported in the bootstrap node.
+	// Empty strings are returned if the locality is not set.
+	Locality() (region, zone, subzone string, err error)
+
+	// RoutedHosts returns the domains of all virtual hosts in the route configuration with the given
+	// name (e.g. "80" or "http.8080"), in config order.
+	RoutedHosts(routeConfigName string) ([]string, error)
+
+	// RouteMirrorPolicies returns the request mirroring policies of the route with the given name.
+	// Returns an empty slice if the route doesn't mirror requests.
+	RouteMirrorPolicies(routeName string) ([]*route.RouteAction_RequestMirrorPolicy, error)
+
+	// MatchRoute simulates route matching in the Envoy configuration for a request with the given
+	// host, path and headers, returning the cluster the request would be routed to. No traffic is sent.
+	// If the host has a port (e.g. "foo.ns.svc.cluster.local:80"), the route configuration for that
+	// port is used, as for a request arriving on the port's listener.
+	MatchRoute(host string, path string, headers map[string]string) (clusterName string, found bool, err error)
+
+	// Raw makes a GET request to the given Envoy admin path (e.g. "stats/prometheus" or "help") and
+	// returns the response body, for endpoints without a dedicated query.
+	Raw(path string) (string, error)
+
+	// SetLogLevel sets the level of the named Envoy logger, or of all loggers if logger is empty.
+	// The level must be one of Envoy's log levels, e.g. "debug" or "trace".
+	SetLogLevel(logger, level string) error
+
+	// GetLogLevels returns the level of each Envoy logger, keyed by logger name.
+	GetLogLevels() (map[string]string, error)
+
 	// Logs returns the logs for the sidecar container
 	Logs() (string, error)
 	// LogsOrFail returns the logs for the sidecar container, or aborts if an error is found
 	LogsOrFail(t test.Failer) string
+	// LogsWithOptions returns the logs for the sidecar container, filtered by the given options
+	LogsWithOptions(opts LogOptions) (string, error)
+	// FollowLogs streams the logs for the sidecar container, one line at a time. The channel is closed
+	// when the context is cancelled or the log stream ends (e.g. the container exits).
+	FollowLogs(ctx context.Context) (<-chan string, error)
+	// Events returns the Kubernetes events for the pod running the proxy, such as failed readiness
+	// probes or image pull errors.
+	Events() ([]corev1.Event, error)
+	EventsOrFail(t test.Failer) []corev1.Event
+	// WaitForLog polls the logs for the sidecar container until a line is accepted by the predicate,
+	// or the retry times out. On timeout, the error includes the last lines of the logs.
+	WaitForLog(predicate func(line string) bool, options ...retry.Option) error
+	WaitForLogOrFail(t test.Failer, predicate func(line string) bool, options ...retry.Option)
 }
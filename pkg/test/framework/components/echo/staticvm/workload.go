@@ -79,6 +79,10 @@ func (w *workload) PodName() string {
 	return ""
 }
 
+func (w *workload) Labels() map[string]string {
+	return nil
+}
+
 func (w *workload) Address() string {
 	return w.address
 }
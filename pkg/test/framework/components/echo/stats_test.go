@@ -0,0 +1,56 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echo
+
+import (
+	"testing"
+)
+
+func TestSumMetricFamily(t *testing.T) {
+	text := `# TYPE envoy_cluster_upstream_rq counter
+envoy_cluster_upstream_rq{response_code="200",cluster_name="outbound|80||b"} 7
+envoy_cluster_upstream_rq{response_code="503",cluster_name="outbound|80||b"} 2
+# TYPE envoy_server_live gauge
+envoy_server_live{} 1
+# TYPE envoy_cluster_upstream_rq_time histogram
+envoy_cluster_upstream_rq_time_bucket{cluster_name="outbound|80||b",le="0.5"} 3
+envoy_cluster_upstream_rq_time_bucket{cluster_name="outbound|80||b",le="+Inf"} 9
+envoy_cluster_upstream_rq_time_sum{cluster_name="outbound|80||b"} 12.5
+envoy_cluster_upstream_rq_time_count{cluster_name="outbound|80||b"} 9
+`
+	families, err := ParsePrometheusStats(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		want float64
+	}{
+		{name: "envoy_cluster_upstream_rq", want: 9},
+		{name: "envoy_server_live", want: 1},
+		{name: "envoy_cluster_upstream_rq_time", want: 9},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mf, ok := families[tc.name]
+			if !ok {
+				t.Fatalf("metric family %s not found", tc.name)
+			}
+			if got := SumMetricFamily(mf); got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
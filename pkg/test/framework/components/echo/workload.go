@@ -51,6 +51,9 @@ type Workload interface {
 	// Sidecar if one was specified.
 	Sidecar() Sidecar
 
+	// Labels of the workload's pod, such as its "version". Nil if the workload doesn't run in a pod.
+	Labels() map[string]string
+
 	// Cluster where this Workload resides.
 	Cluster() cluster.Cluster
 
@@ -276,6 +276,16 @@ func (n *kubeNamespace) addCleanup(fn func() error) {
 	n.cleanupFuncs = append(n.cleanupFuncs, fn)
 }
 
+// takeCleanups removes and returns the cleanup functions for this namespace, so that the caller
+// becomes responsible for deleting it.
+func (n *kubeNamespace) takeCleanups() []func() error {
+	n.cleanupMutex.Lock()
+	defer n.cleanupMutex.Unlock()
+	out := n.cleanupFuncs
+	n.cleanupFuncs = nil
+	return out
+}
+
 func (n *kubeNamespace) IsAmbient() bool {
 	// TODO cache labels and invalidate on SetLabel to avoid a ton of kube calls
 	labels, err := n.Labels()
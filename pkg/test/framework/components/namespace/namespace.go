@@ -15,8 +15,11 @@
 package namespace
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
+
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/framework/resource"
 	"istio.io/istio/pkg/test/scopes"
@@ -113,6 +116,65 @@ func NewOrFail(t test.Failer, ctx resource.Context, nsConfig Config) Instance {
 	return i
 }
 
+// NewMany creates a new Namespace in all clusters for each of the given configs. The namespaces are
+// created in parallel and are deleted together by a single cleanup when the context completes. If
+// any of the namespaces fails to be created, the ones that were created are deleted immediately.
+func NewMany(ctx resource.Context, configs ...Config) ([]Instance, error) {
+	out := make([]Instance, len(configs))
+	g := multierror.Group{}
+	for i, cfg := range configs {
+		i, cfg := i, cfg
+		g.Go(func() error {
+			ns, err := New(ctx, cfg)
+			if err != nil {
+				return fmt.Errorf("failed creating namespace %s: %v", cfg.Prefix, err)
+			}
+			out[i] = ns
+			return nil
+		})
+	}
+	createErr := g.Wait().ErrorOrNil()
+
+	// Take ownership of the cleanup of all created namespaces, so they can be deleted together.
+	var cleanups []func() error
+	for _, ns := range out {
+		if kns, ok := ns.(*kubeNamespace); ok {
+			cleanups = append(cleanups, kns.takeCleanups()...)
+		}
+	}
+	deleteAll := func() error {
+		cg := multierror.Group{}
+		for _, cleanup := range cleanups {
+			cg.Go(cleanup)
+		}
+		return cg.Wait().ErrorOrNil()
+	}
+
+	if createErr != nil {
+		if err := deleteAll(); err != nil {
+			scopes.Framework.Errorf("failed cleaning up namespaces after creation failure: %v", err)
+		}
+		return nil, createErr
+	}
+
+	ctx.CleanupConditionally(func() {
+		if err := deleteAll(); err != nil {
+			scopes.Framework.Errorf("failed deleting namespaces: %v", err)
+		}
+	})
+	return out, nil
+}
+
+// NewManyOrFail calls NewMany and fails test if it returns error
+func NewManyOrFail(t test.Failer, ctx resource.Context, configs ...Config) []Instance {
+	t.Helper()
+	i, err := NewMany(ctx, configs...)
+	if err != nil {
+		t.Fatalf("namespace.NewManyOrFail: %v", err)
+	}
+	return i
+}
+
 // GetAll returns all namespaces that have exist in the context.
 func GetAll(ctx resource.Context) ([]Instance, error) {
 	var out []Instance